@@ -2,63 +2,137 @@ package corefactorer
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log/slog"
-	"os"
 	"strings"
 
-	"github.com/google/generative-ai-go/genai"
-	"github.com/liushuangls/go-anthropic/v2"
-	"github.com/sashabaranov/go-openai"
-	"google.golang.org/api/option"
+	"github.com/sashabaranov/go-openai/jsonschema"
 )
 
 type Agent interface {
 	// CreateRefactoringTarget creates `RefactoringTarget` from the given prompt with GenAI FunctionCalling feature
 	CreateRefactoringTarget(ctx context.Context, prompt string, model string, temperature float32) (*RefactoringTarget, error)
 
+	// SetModel sets the model and the temperature without CreateRefactoringTarget when `RefactoringTarget` is given explicitly.
+	// CreateRefactoringResult starts a new conversation in that case since there's no ToolCall to continue.
+	SetModel(model string, temperature float32)
+
 	// CreateRefactoringResult sends a request of refactoring to GenAI API.
 	// The chat message in the request includes an original user prompt and fetched pull-request info and file content in given `RefactoringRequest`.
+	// The result is requested as structured output through `submitRefactoringResult` function.
 	CreateRefactoringResult(ctx context.Context, req *RefactoringRequest) (*RefactoringResult, error)
+
+	// RepairRefactoringResult sends the failure of the verification and the current file contents back to GenAI API
+	// in the same conversation as `req.Previous`, and asks to fix the refactoring.
+	RepairRefactoringResult(ctx context.Context, req *RepairRequest) (*RefactoringResult, error)
 }
 
 const (
 	functionName                  = "extractRefactoringTarget"
 	functionDescription           = "extractRefactoringTarget"
 	functionParameter1Name        = "pullRequestUrls"
-	functionParameter1Description = "Pull-request URLs in GitHub to refer to for refactoring"
+	functionParameter1Description = "Pull-request URLs in GitHub, Gitea and Bitbucket Server or merge request URLs in GitLab to refer to for refactoring. Commit URLs (/commit/<sha>) and compare URLs (/compare/<base>...<head>) in GitHub, local git references like `git:HEAD~1` or `git:abc123..def456` and `.patch`/`.diff` files are also included as they are. Empty if no pull-request is given"
 	functionParameter2Name        = "files"
-	functionParameter2Description = "List of target files to be refactored"
+	functionParameter2Description = "List of target files to be refactored. A glob pattern like **/*_test.go, a directory and a Go package pattern like ./internal/... are also accepted"
+
+	resultFunctionName                        = "submitRefactoringResult"
+	resultFunctionDescription                 = "Submit the result of refactoring. Every refactored file must be included with its full content"
+	resultFunctionParameterName               = "files"
+	resultFunctionParameterDescription        = "List of refactored files"
+	resultFileParameterPath                   = "path"
+	resultFileParameterPathDescription        = "Path of the refactored file. It must be same as the path of the target file"
+	resultFileParameterContent                = "content"
+	resultFileParameterContentDescription     = "Full content of the refactored file"
+	resultFileParameterExplanation            = "explanation"
+	resultFileParameterExplanationDescription = "Short explanation of the changes"
 
 	claudeAPIKeyEnv = "CLAUDE_API_KEY"
 	geminiAPIKeyEnv = "GEMINI_API_KEY"
 	openAIAPIKeyEnv = "OPENAI_API_KEY"
+	ollamaHostEnv   = "OLLAMA_HOST"
 )
 
-func NewAgent(model string, logger *slog.Logger) (Agent, error) {
-	if strings.HasPrefix(model, "claude") {
-		apiKey := os.Getenv(claudeAPIKeyEnv)
-		if apiKey == "" {
-			return nil, fmt.Errorf("Env '%s' must be defined for model %s", claudeAPIKeyEnv, model)
-		}
-		client := anthropic.NewClient(apiKey)
-		return NewClaudeAgent(client, logger), nil
-	} else if strings.HasPrefix(model, "gemini") {
-		apiKey := os.Getenv(geminiAPIKeyEnv)
-		if apiKey == "" {
-			return nil, fmt.Errorf("Env '%s' must be defined for model %s", geminiAPIKeyEnv, model)
-		}
-		client, err := genai.NewClient(context.Background(), option.WithAPIKey(apiKey))
-		if err != nil {
-			return nil, fmt.Errorf("genai.NewClient failed: %w", err)
-		}
-		return NewGeminiAgent(client, logger), nil
-	} else {
-		apiKey := os.Getenv(openAIAPIKeyEnv)
-		if apiKey == "" {
-			return nil, fmt.Errorf("Env '%s' must be defined for model %s", openAIAPIKeyEnv, model)
+// resultFunctionParameters returns JSON schema of the parameters of `submitRefactoringResult` function
+// which is used to receive `RefactoringResult` as structured output.
+func resultFunctionParameters() jsonschema.Definition {
+	return jsonschema.Definition{
+		Type: jsonschema.Object,
+		Properties: map[string]jsonschema.Definition{
+			resultFunctionParameterName: {
+				Type:        jsonschema.Array,
+				Description: resultFunctionParameterDescription,
+				Items: &jsonschema.Definition{
+					Type: jsonschema.Object,
+					Properties: map[string]jsonschema.Definition{
+						resultFileParameterPath: {
+							Type:        jsonschema.String,
+							Description: resultFileParameterPathDescription,
+						},
+						resultFileParameterContent: {
+							Type:        jsonschema.String,
+							Description: resultFileParameterContentDescription,
+						},
+						resultFileParameterExplanation: {
+							Type:        jsonschema.String,
+							Description: resultFileParameterExplanationDescription,
+						},
+					},
+					Required: []string{resultFileParameterPath, resultFileParameterContent, resultFileParameterExplanation},
+				},
+			},
+		},
+		Required: []string{resultFunctionParameterName},
+	}
+}
+
+// parseResultFunctionArguments parses arguments of `submitRefactoringResult` function in JSON.
+func parseResultFunctionArguments(arguments []byte) ([]*RefactoredFile, error) {
+	var args struct {
+		Files []*RefactoredFile
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, fmt.Errorf("failed to json.Unmarshal: %w", err)
+	}
+	if len(args.Files) == 0 {
+		return nil, fmt.Errorf("no files in arguments of %s", resultFunctionName)
+	}
+	for _, f := range args.Files {
+		if f.Path == "" {
+			return nil, fmt.Errorf("empty path in arguments of %s", resultFunctionName)
 		}
-		client := openai.NewClient(apiKey)
-		return NewOpenAIAgent(client, logger), nil
 	}
+	return args.Files, nil
+}
+
+// errNoConversation is returned from RepairRefactoringResult when the previous result has no conversation to continue.
+var errNoConversation = errors.New("no conversation to repair the result")
+
+// errNoAgent is returned when a method which requires GenAI is called on App created without an Agent.
+var errNoAgent = errors.New("no agent to call GenAI")
+
+// trimProviderName trims `<providerName>/` prefix from the model name.
+func trimProviderName(model string, providerName string) string {
+	return strings.TrimPrefix(model, providerName+"/")
+}
+
+// AgentConfig is a configuration to create an Agent.
+type AgentConfig struct {
+	OpenAI *OpenAIConfig
+	// ContextWindow overrides the context window of the model in tokens if it's positive. It's sent to Ollama as `num_ctx`.
+	ContextWindow int
+	// MaxOutputTokens is max tokens of a response. NewAgent sets the known value of the model if it's not positive.
+	MaxOutputTokens int
+	// APIKeyEnv overrides the environment variable of the API key of the provider like OPENAI_API_KEY if it's not empty.
+	APIKeyEnv string
+	// SystemPrompt is sent with the native system prompt mechanism of the provider in every request if it's not empty.
+	SystemPrompt string
+}
+
+// apiKeyEnv returns APIKeyEnv if it's specified, otherwise `defaultEnv`.
+func (c *AgentConfig) apiKeyEnv(defaultEnv string) string {
+	if c.APIKeyEnv != "" {
+		return c.APIKeyEnv
+	}
+	return defaultEnv
 }
@@ -0,0 +1,132 @@
+package corefactorer
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// AgentProvider is a provider of Agent like OpenAI, Claude and Gemini. Providers are registered with `RegisterAgentProvider`.
+type AgentProvider struct {
+	// Name is a unique name of the provider. A model like `<Name>/<model>` is always served by the provider.
+	Name string
+	// Description is a human-readable description of the provider.
+	Description string
+	// ModelPrefixes are prefixes of model names served by the provider.
+	ModelPrefixes []string
+	// Models are known models of the provider. It's used for listing only, so other models can be used.
+	Models []string
+	// RequiredEnvs are environment variables which must be defined to use the provider.
+	RequiredEnvs []string
+	// ContextWindows are context windows in tokens keyed by prefix of model names. The longest matched prefix is used.
+	ContextWindows map[string]int
+	// DefaultContextWindow is a context window in tokens of models which don't match ContextWindows.
+	DefaultContextWindow int
+	// MaxOutputTokens are max tokens of a response keyed by prefix of model names. The longest matched prefix is used.
+	MaxOutputTokens map[string]int
+	// DefaultMaxOutputTokens is max tokens of a response of models which don't match MaxOutputTokens.
+	// Zero means that a response is limited only by the context window.
+	DefaultMaxOutputTokens int
+	// CharsPerToken is an average number of ASCII characters per token of the tokenizer to estimate tokens.
+	CharsPerToken float64
+	// New creates an Agent for the model.
+	New func(model string, config *AgentConfig, logger *slog.Logger) (Agent, error)
+}
+
+// Match reports whether the provider serves the model.
+func (p *AgentProvider) Match(model string) bool {
+	if strings.HasPrefix(model, p.Name+"/") {
+		return true
+	}
+	for _, prefix := range p.ModelPrefixes {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	agentProvidersMu sync.RWMutex
+	agentProviders   = make(map[string]*AgentProvider)
+)
+
+// RegisterAgentProvider registers the provider. It panics if the provider is registered twice or it's invalid.
+func RegisterAgentProvider(p *AgentProvider) {
+	agentProvidersMu.Lock()
+	defer agentProvidersMu.Unlock()
+	if p == nil || p.Name == "" || p.New == nil {
+		panic("corefactorer: RegisterAgentProvider: Name and New must be specified")
+	}
+	if _, ok := agentProviders[p.Name]; ok {
+		panic("corefactorer: RegisterAgentProvider called twice for provider " + p.Name)
+	}
+	agentProviders[p.Name] = p
+}
+
+// AgentProviders returns the registered providers sorted by name.
+func AgentProviders() []*AgentProvider {
+	agentProvidersMu.RLock()
+	defer agentProvidersMu.RUnlock()
+	providers := make([]*AgentProvider, 0, len(agentProviders))
+	for _, p := range agentProviders {
+		providers = append(providers, p)
+	}
+	slices.SortFunc(providers, func(a, b *AgentProvider) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return providers
+}
+
+// FindAgentProvider returns the provider which serves the model.
+func FindAgentProvider(model string) (*AgentProvider, error) {
+	providers := AgentProviders()
+	// `<Name>/<model>` takes precedence over ModelPrefixes
+	for _, p := range providers {
+		if strings.HasPrefix(model, p.Name+"/") {
+			return p, nil
+		}
+	}
+	for _, p := range providers {
+		if p.Match(model) {
+			return p, nil
+		}
+	}
+
+	names := make([]string, len(providers))
+	for i, p := range providers {
+		names[i] = p.Name
+	}
+	return nil, fmt.Errorf(
+		"unknown model '%s': no provider serves it. Use `<provider>/<model>` format to specify a provider explicitly (providers: %s). Run `co-refactorer models` to list known models",
+		model, strings.Join(names, ", "),
+	)
+}
+
+// NewAgent creates an Agent for the model with the registered provider.
+func NewAgent(model string, config *AgentConfig, logger *slog.Logger) (Agent, error) {
+	p, err := FindAgentProvider(model)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &AgentConfig{}
+	}
+	if config.MaxOutputTokens <= 0 {
+		// Copy not to modify the config of the caller
+		c := *config
+		c.MaxOutputTokens = p.maxOutputTokens(model)
+		config = &c
+	}
+	for _, env := range p.RequiredEnvs {
+		// RequiredEnvs of the providers are API keys, which can be overridden with AgentConfig.APIKeyEnv
+		env = config.apiKeyEnv(env)
+		if os.Getenv(env) == "" {
+			return nil, fmt.Errorf("Env '%s' must be defined for model %s", env, model)
+		}
+	}
+	return p.New(model, config, logger)
+}
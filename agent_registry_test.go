@@ -0,0 +1,62 @@
+package corefactorer
+
+import (
+	"testing"
+)
+
+func Test_FindAgentProvider(t *testing.T) {
+	type args struct {
+		model string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "openai",
+			args: args{model: "gpt-4o-mini"},
+			want: "openai",
+		},
+		{
+			name: "openai-compatible with explicit provider name",
+			args: args{model: "openai/meta-llama/Llama-3.1-8B-Instruct"},
+			want: "openai",
+		},
+		{
+			name: "claude",
+			args: args{model: "claude-3-5-sonnet-20240620"},
+			want: "claude",
+		},
+		{
+			name: "gemini",
+			args: args{model: "gemini-1.5-pro"},
+			want: "gemini",
+		},
+		{
+			name: "ollama",
+			args: args{model: "ollama/llama3.1"},
+			want: "ollama",
+		},
+		{
+			name:    "typo",
+			args:    args{model: "clade-3"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FindAgentProvider(tt.args.model)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FindAgentProvider() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Name != tt.want {
+				t.Errorf("FindAgentProvider() got = %v, want %v", got.Name, tt.want)
+			}
+		})
+	}
+}
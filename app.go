@@ -3,36 +3,40 @@ package corefactorer
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/antchfx/htmlquery"
-	"github.com/google/go-github/v65/github"
 	"github.com/sashabaranov/go-openai"
 	"github.com/yuin/goldmark"
 )
 
 type App struct {
-	logger       *slog.Logger
-	agent        Agent
-	githubClient *github.Client
-	httpClient   *http.Client
+	logger           *slog.Logger
+	agent            Agent
+	referenceSources []ReferenceSource
+	httpClient       *http.Client
 }
 
 func New(
 	logger *slog.Logger,
 	agent Agent,
-	githubClient *github.Client,
+	referenceSources []ReferenceSource,
 	httpClient *http.Client,
 ) *App {
 	return &App{
-		logger:       logger,
-		agent:        agent,
-		githubClient: githubClient,
-		httpClient:   httpClient,
+		logger:           logger,
+		agent:            agent,
+		referenceSources: referenceSources,
+		httpClient:       httpClient,
 	}
 }
 
@@ -46,50 +50,30 @@ func (a *App) CreateRefactoringTarget(
 	return a.agent.CreateRefactoringTarget(ctx, prompt, model, temperature)
 }
 
+// SetModel sets the model and the temperature of the agent without CreateRefactoringTarget.
+// It's required before CreateRefactoringResult when `RefactoringTarget` is not created by CreateRefactoringTarget.
+func (a *App) SetModel(model string, temperature float32) {
+	a.agent.SetModel(model, temperature)
+}
+
 // CreateRefactoringRequest creates `RefactoringRequest`.
 // It fetches pull request content from GitHub and file content local machine.
 func (a *App) CreateRefactoringRequest(ctx context.Context, target *RefactoringTarget) (*RefactoringRequest, error) {
 	request := &RefactoringRequest{
 		ToolCallID: target.ToolCallID,
 		UserPrompt: target.UserPrompt,
+		NewFiles:   target.NewFiles,
 	}
 	for _, prURL := range target.PullRequestURLs {
-		owner, repo, number, err := parsePullRequestURL(prURL)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse pull-request url '%s': %w", prURL, err)
-		}
-		pr, _, err := a.githubClient.PullRequests.Get(ctx, owner, repo, int(number))
-		if err != nil {
-			// TODO: More readable error message like `failed to retrieve the pull-request. You may not have permission to access it.`
-			return nil, fmt.Errorf("failed to get pull-request content '%s': %w", prURL, err)
-		}
-
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, pr.GetURL(), nil)
-		if err != nil {
-			return nil, fmt.Errorf("failed to NewRequestWithContext: %w", err)
-		}
-		req.Header.Add("Accept", "application/vnd.github.diff")
-		// Use `Client()` to add authentication header in request
-		resp, err := a.githubClient.Client().Do(req)
+		source, err := findReferenceSource(a.referenceSources, prURL)
 		if err != nil {
-			return nil, fmt.Errorf("failed to Do HTTP request: %w", err)
+			return nil, err
 		}
-		defer resp.Body.Close()
-		body, err := io.ReadAll(resp.Body) // Read the response body even if the status code is not 200.
+		pr, err := source.Fetch(ctx, prURL)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read response body: %w", err)
+			return nil, err
 		}
-		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("failed to get a diff of pull-request '%s': status code from GitHub is %d: %s", pr.GetURL(), resp.StatusCode, string(body))
-		}
-
-		request.PullRequests = append(request.PullRequests, &PullRequest{
-			URL:  prURL,
-			Diff: string(body),
-			// Title and Body are not used yet, maybe use them in the future.
-			Title: pr.GetTitle(),
-			Body:  pr.GetBody(),
-		})
+		request.PullRequests = append(request.PullRequests, pr)
 	}
 
 	for _, f := range target.Files {
@@ -116,31 +100,257 @@ func (a *App) CreateRefactoringResult(ctx context.Context, req *RefactoringReque
 	return a.agent.CreateRefactoringResult(ctx, req)
 }
 
-func (a *App) ApplyRefactoringResult(ctx context.Context, result *RefactoringResult) error {
-	targetFiles, err := a.parseMarkdownContent(result.RawContent)
+// RefactoringOutcome is a result or an error of a request in CreateRefactoringResults.
+type RefactoringOutcome struct {
+	Request *RefactoringRequest
+	Result  *RefactoringResult
+	Err     error
+}
+
+// CreateRefactoringResults sends the requests concurrently with at most `workers` requests at a time.
+// An error of a request doesn't stop the others, so the outcomes contain both results and errors
+// in the same order as `requests`.
+func (a *App) CreateRefactoringResults(ctx context.Context, requests []*RefactoringRequest, workers int) []*RefactoringOutcome {
+	if workers <= 0 {
+		workers = 1
+	}
+	outcomes := make([]*RefactoringOutcome, len(requests))
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, req := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			outcome := &RefactoringOutcome{Request: req}
+			if err := ctx.Err(); err != nil {
+				outcome.Err = err
+			} else {
+				outcome.Result, outcome.Err = a.CreateRefactoringResult(ctx, req)
+			}
+			if outcome.Err != nil {
+				a.logger.Info(
+					fmt.Sprintf("Failed to refactor %s", strings.Join(req.TargetPaths(), ", ")),
+					slog.String("error", outcome.Err.Error()),
+				)
+			}
+			outcomes[i] = outcome
+		}()
+	}
+	wg.Wait()
+	return outcomes
+}
+
+// AppliedFile is a file written by ApplyRefactoringResult. It keeps the original content to restore the file.
+type AppliedFile struct {
+	// Path is a path relative to the working directory.
+	Path string
+	// Original is the original content of the file. It's nil if the file is newly created.
+	Original []byte
+}
+
+// ApplyRefactoringResult overwrites the target files with the refactored files in the result.
+// Each file is written atomically. Only the target files and the new files in `req` inside the working tree can be written.
+// If writing any file fails, files already written are restored.
+func (a *App) ApplyRefactoringResult(ctx context.Context, req *RefactoringRequest, result *RefactoringResult) ([]*AppliedFile, error) {
+	workDir, err := os.Getwd()
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	targetFiles, err := a.allowedRefactoredFiles(workDir, req, result)
+	if err != nil {
+		return nil, err
 	}
 
+	applied := make([]*AppliedFile, 0, len(targetFiles))
 	for _, tf := range targetFiles {
 		a.logger.Debug(
 			"Applying refactoring result",
 			slog.String("path", tf.Path), slog.String("content", tf.Content),
 		)
-		f, err := os.OpenFile(tf.Path, os.O_RDWR, 0644)
-		if err != nil {
-			return fmt.Errorf("failed to open file '%s': %w", tf.Path, err)
+		path := filepath.Join(workDir, tf.Path)
+		original, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, errors.Join(
+				fmt.Errorf("failed to read file '%s': %w", tf.Path, err),
+				a.RestoreFiles(ctx, applied),
+			)
 		}
-		defer f.Close()
-		if _, err := fmt.Fprintf(f, "%s", tf.Content); err != nil {
-			return fmt.Errorf("failed to write content to file '%s': %w", tf.Path, err)
+		if err := writeFileAtomic(path, []byte(tf.Content)); err != nil {
+			return nil, errors.Join(
+				fmt.Errorf("failed to write content to file '%s': %w", tf.Path, err),
+				a.RestoreFiles(ctx, applied),
+			)
 		}
+		applied = append(applied, &AppliedFile{
+			Path:     tf.Path,
+			Original: original,
+		})
 		a.logger.Info(fmt.Sprintf("%s is modified", tf.Path))
 	}
 
+	return applied, nil
+}
+
+// StaleFiles returns the paths of the refactored files in the result which are modified after `req` was created.
+// A target file is stale if its current content differs from the content in `req`, and a new file is stale if it exists.
+// Applying the result to a stale file reverts the modification, so it should be refused. It's useful to apply an old result.
+func (a *App) StaleFiles(req *RefactoringRequest, result *RefactoringResult) ([]string, error) {
+	workDir, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	return a.staleFiles(workDir, req, result)
+}
+
+func (a *App) staleFiles(workDir string, req *RefactoringRequest, result *RefactoringResult) ([]string, error) {
+	targetFiles, err := a.allowedRefactoredFiles(workDir, req, result)
+	if err != nil {
+		return nil, err
+	}
+	fetched := make(map[string]string, len(req.TargetFiles))
+	for _, tf := range req.TargetFiles {
+		rel, err := relativePathInDir(workDir, tf.Path)
+		if err != nil {
+			return nil, err
+		}
+		fetched[rel] = tf.Content
+	}
+
+	var stale []string
+	for _, tf := range targetFiles {
+		current, err := os.ReadFile(filepath.Join(workDir, tf.Path))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read file '%s': %w", tf.Path, err)
+		}
+		exists := err == nil
+		content, isTarget := fetched[tf.Path]
+		if (isTarget && (!exists || string(current) != content)) || (!isTarget && exists) {
+			stale = append(stale, tf.Path)
+		}
+	}
+	return stale, nil
+}
+
+// RestoreFiles restores the files written by ApplyRefactoringResult to the original content.
+// Newly created files are removed. The files are restored in reverse order so that a file written twice
+// gets back the content before the first write.
+func (a *App) RestoreFiles(ctx context.Context, files []*AppliedFile) error {
+	var errs []error
+	for i := len(files) - 1; i >= 0; i-- {
+		f := files[i]
+		if f.Original == nil {
+			if err := os.Remove(f.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, fmt.Errorf("failed to remove file '%s': %w", f.Path, err))
+				continue
+			}
+			a.logger.Info(fmt.Sprintf("%s is removed", f.Path))
+			continue
+		}
+		if err := writeFileAtomic(f.Path, f.Original); err != nil {
+			errs = append(errs, fmt.Errorf("failed to restore file '%s': %w", f.Path, err))
+			continue
+		}
+		a.logger.Info(fmt.Sprintf("%s is restored", f.Path))
+	}
+	return errors.Join(errs...)
+}
+
+// DiffRefactoringResult writes a unified diff between the target files on disk and the refactored files in the result to `w`.
+// It doesn't modify any files, and the output can be applied with `git apply`.
+func (a *App) DiffRefactoringResult(ctx context.Context, req *RefactoringRequest, result *RefactoringResult, w io.Writer, colored bool) error {
+	workDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+	targetFiles, err := a.allowedRefactoredFiles(workDir, req, result)
+	if err != nil {
+		return err
+	}
+
+	for _, tf := range targetFiles {
+		var before *string
+		content, err := os.ReadFile(filepath.Join(workDir, tf.Path))
+		if err == nil {
+			s := string(content)
+			before = &s
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to read file '%s': %w", tf.Path, err)
+		}
+
+		diff := unifiedDiff(tf.Path, before, tf.Content)
+		if diff == "" {
+			a.logger.Info(fmt.Sprintf("%s has no changes", tf.Path))
+			continue
+		}
+		if colored {
+			diff = colorizeDiff(diff)
+		}
+		if _, err := io.WriteString(w, diff); err != nil {
+			return fmt.Errorf("failed to write diff of '%s': %w", tf.Path, err)
+		}
+	}
 	return nil
 }
 
+// allowedRefactoredFiles returns refactored files in the result with paths relative to `workDir`.
+// It returns an error if any of them is not a target file or a new file in `req`, or is outside of `workDir`.
+func (a *App) allowedRefactoredFiles(workDir string, req *RefactoringRequest, result *RefactoringResult) ([]*TargetFile, error) {
+	targetFiles, err := a.refactoredTargetFiles(result)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := make(map[string]struct{}, len(req.TargetFiles)+len(req.NewFiles))
+	paths := make([]string, 0, len(req.TargetFiles)+len(req.NewFiles))
+	for _, tf := range req.TargetFiles {
+		paths = append(paths, tf.Path)
+	}
+	paths = append(paths, req.NewFiles...)
+	for _, p := range paths {
+		rel, err := relativePathInDir(workDir, p)
+		if err != nil {
+			return nil, err
+		}
+		allowed[rel] = struct{}{}
+	}
+
+	for _, tf := range targetFiles {
+		rel, err := relativePathInDir(workDir, tf.Path)
+		if err != nil {
+			return nil, fmt.Errorf("refused to write '%s': %w", tf.Path, err)
+		}
+		if _, ok := allowed[rel]; !ok {
+			return nil, fmt.Errorf("refused to write '%s': it's neither a target file nor an allowed new file", tf.Path)
+		}
+		tf.Path = rel
+	}
+	return targetFiles, nil
+}
+
+// refactoredTargetFiles returns refactored files in the result.
+// It uses structured output if available, otherwise parses RawContent as Markdown.
+func (a *App) refactoredTargetFiles(result *RefactoringResult) ([]*TargetFile, error) {
+	if len(result.Files) == 0 {
+		a.logger.Debug("No structured output in the result, parsing RawContent as Markdown")
+		return a.parseMarkdownContent(result.RawContent)
+	}
+
+	targetFiles := make([]*TargetFile, len(result.Files))
+	for i, f := range result.Files {
+		if f.Explanation != "" {
+			a.logger.Info(fmt.Sprintf("%s: %s", f.Path, f.Explanation))
+		}
+		targetFiles[i] = &TargetFile{
+			Path:    f.Path,
+			Content: f.Content,
+		}
+	}
+	return targetFiles, nil
+}
+
 func (a *App) parseMarkdownContent(content string) ([]*TargetFile, error) {
 	var out bytes.Buffer
 	if err := goldmark.Convert([]byte(content), &out); err != nil {
@@ -1,10 +1,19 @@
 package corefactorer
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func Test_App_parseMarkdownContent(t *testing.T) {
@@ -44,3 +53,290 @@ func Test_App_parseMarkdownContent(t *testing.T) {
 		})
 	}
 }
+
+func Test_App_refactoredTargetFiles(t *testing.T) {
+	type args struct {
+		result *RefactoringResult
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []*TargetFile
+		wantErr bool
+	}{
+		{
+			name: "structured output",
+			args: args{
+				result: &RefactoringResult{
+					RawContent: "### Explanation\n\nI refactored a.go.\n",
+					Files: []*RefactoredFile{
+						{Path: "a.go", Content: "package main\n", Explanation: "Remove unused import"},
+					},
+				},
+			},
+			want: []*TargetFile{
+				{Path: "a.go", Content: "package main\n"},
+			},
+		},
+		{
+			name: "fallback to Markdown",
+			args: args{
+				result: &RefactoringResult{
+					RawContent: "### a.go\n\n```go\npackage main\n```\n",
+				},
+			},
+			want: []*TargetFile{
+				{Path: "a.go", Content: "package main\n"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := New(slog.New(slog.NewTextHandler(os.Stdout, nil)), nil, nil, nil)
+			got, err := app.refactoredTargetFiles(tt.args.result)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("refactoredTargetFiles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("refactoredTargetFiles() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_App_allowedRefactoredFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte("package a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	req := &RefactoringRequest{
+		TargetFiles: []*TargetFile{{Path: "a.go"}},
+		NewFiles:    []string{"b.go"},
+	}
+
+	type args struct {
+		files []*RefactoredFile
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "target file and new file",
+			args: args{files: []*RefactoredFile{{Path: "./a.go"}, {Path: "b.go"}}},
+		},
+		{
+			name:    "not a target file",
+			args:    args{files: []*RefactoredFile{{Path: "c.go"}}},
+			wantErr: true,
+		},
+		{
+			name:    "outside of working tree",
+			args:    args{files: []*RefactoredFile{{Path: "../../etc/passwd"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := New(slog.New(slog.NewTextHandler(os.Stdout, nil)), nil, nil, nil)
+			_, err := app.allowedRefactoredFiles(dir, req, &RefactoringResult{Files: tt.args.files})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("allowedRefactoredFiles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_App_staleFiles(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"a.go": "package a\n", "b.go": "package b\n\nfunc B() {}\n", "d.go": "package d\n"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := &RefactoringRequest{
+		TargetFiles: []*TargetFile{
+			{Path: "a.go", Content: "package a\n"},
+			{Path: "./b.go", Content: "package b\n"},
+			{Path: "c.go", Content: "package c\n"},
+		},
+		NewFiles: []string{"d.go", "e.go"},
+	}
+
+	tests := map[string]struct {
+		files []*RefactoredFile
+		want  []string
+	}{
+		"unchanged target file": {
+			files: []*RefactoredFile{{Path: "a.go"}},
+		},
+		"modified target file": {
+			files: []*RefactoredFile{{Path: "a.go"}, {Path: "b.go"}},
+			want:  []string{"b.go"},
+		},
+		"removed target file": {
+			files: []*RefactoredFile{{Path: "c.go"}},
+			want:  []string{"c.go"},
+		},
+		"new file created after fetch": {
+			files: []*RefactoredFile{{Path: "d.go"}, {Path: "e.go"}},
+			want:  []string{"d.go"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app := New(slog.New(slog.NewTextHandler(io.Discard, nil)), nil, nil, nil)
+			got, err := app.staleFiles(dir, req, &RefactoringResult{Files: tt.files})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("staleFiles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_App_CreateRefactoringRequest_GitHubEnterpriseServer(t *testing.T) {
+	const diff = "diff --git a/a.go b/a.go\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/repos/oinume/co-refactorer/pulls/1" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer enterprise-token" {
+			t.Errorf("Authorization = %v, want %v", got, "Bearer enterprise-token")
+		}
+		if r.Header.Get("Accept") == "application/vnd.github.diff" {
+			_, _ = io.WriteString(w, diff)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"url":"http://%s/api/v3/repos/oinume/co-refactorer/pulls/1","title":"Rename","body":"Rename a function"}`, r.Host)
+	}))
+	defer server.Close()
+
+	clients, err := NewGitHubClients(server.Client(), []*GitHubHost{
+		{Host: "github.example.com", APIBaseURL: server.URL + "/api/v3/", Token: "enterprise-token"},
+	})
+	if err != nil {
+		t.Fatalf("NewGitHubClients() error = %v", err)
+	}
+	a := New(slog.Default(), nil, []ReferenceSource{NewGitHubSource(clients, false)}, server.Client())
+
+	tests := []struct {
+		name    string
+		prURL   string
+		want    []*PullRequest
+		wantErr string
+	}{
+		{
+			name:  "ok",
+			prURL: "https://github.example.com/oinume/co-refactorer/pull/1",
+			want: []*PullRequest{
+				{
+					URL:   "https://github.example.com/oinume/co-refactorer/pull/1",
+					Title: "Rename",
+					Body:  "Rename a function",
+					Diff:  diff,
+				},
+			},
+		},
+		{
+			name:    "host not allowed",
+			prURL:   "https://github.com/oinume/co-refactorer/pull/1",
+			wantErr: "GitHub host 'github.com' is not allowed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.CreateRefactoringRequest(context.Background(), &RefactoringTarget{
+				PullRequestURLs: []string{tt.prURL},
+			})
+			if (err != nil) != (tt.wantErr != "") {
+				t.Fatalf("CreateRefactoringRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("CreateRefactoringRequest() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got.PullRequests, tt.want) {
+				t.Errorf("CreateRefactoringRequest() PullRequests = %+v, want %+v", got.PullRequests, tt.want)
+			}
+		})
+	}
+}
+
+// concurrentAgent is an Agent which fails for `failPath` and records the max number of concurrent calls.
+type concurrentAgent struct {
+	Agent
+	failPath string
+
+	mu            sync.Mutex
+	running       int
+	maxConcurrent int
+}
+
+func (a *concurrentAgent) CreateRefactoringResult(ctx context.Context, req *RefactoringRequest) (*RefactoringResult, error) {
+	a.mu.Lock()
+	a.running++
+	a.maxConcurrent = max(a.maxConcurrent, a.running)
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		a.running--
+		a.mu.Unlock()
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	path := req.TargetFiles[0].Path
+	if path == a.failPath {
+		return nil, fmt.Errorf("failed to refactor %s", path)
+	}
+	return &RefactoringResult{Files: []*RefactoredFile{{Path: path}}}, nil
+}
+
+func Test_App_CreateRefactoringResults(t *testing.T) {
+	const workers = 2
+	agent := &concurrentAgent{failPath: "c.go"}
+	app := New(slog.New(slog.NewTextHandler(io.Discard, nil)), agent, nil, nil)
+	req := &RefactoringRequest{
+		UserPrompt: "Refactor files",
+		TargetFiles: []*TargetFile{
+			{Path: "a.go"}, {Path: "b.go"}, {Path: "c.go"}, {Path: "d.go"}, {Path: "e.go"},
+		},
+	}
+
+	outcomes := app.CreateRefactoringResults(context.Background(), req.SplitPerFile(), workers)
+	if len(outcomes) != len(req.TargetFiles) {
+		t.Fatalf("CreateRefactoringResults() returned %d outcomes, want %d", len(outcomes), len(req.TargetFiles))
+	}
+	for i, outcome := range outcomes {
+		wantPath := req.TargetFiles[i].Path
+		if got := outcome.Request.TargetPaths(); !reflect.DeepEqual(got, []string{wantPath}) {
+			t.Errorf("outcomes[%d].Request.TargetPaths() = %v, want %v", i, got, []string{wantPath})
+		}
+		if outcome.Request.UserPrompt != req.UserPrompt {
+			t.Errorf("outcomes[%d].Request.UserPrompt = %q, want %q", i, outcome.Request.UserPrompt, req.UserPrompt)
+		}
+		if wantPath == agent.failPath {
+			if outcome.Err == nil {
+				t.Errorf("outcomes[%d].Err = nil, want an error", i)
+			}
+			continue
+		}
+		if outcome.Err != nil {
+			t.Errorf("outcomes[%d].Err = %v", i, outcome.Err)
+			continue
+		}
+		if got := outcome.Result.Files[0].Path; got != wantPath {
+			t.Errorf("outcomes[%d].Result.Files[0].Path = %v, want %v", i, got, wantPath)
+		}
+	}
+	if agent.maxConcurrent > workers {
+		t.Errorf("max concurrent requests = %d, want <= %d", agent.maxConcurrent, workers)
+	}
+}
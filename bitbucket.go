@@ -0,0 +1,139 @@
+package corefactorer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	bitbucketTokenEnv = "BITBUCKET_TOKEN"
+	bitbucketHostsEnv = "BITBUCKET_HOSTS"
+)
+
+// ParseBitbucketHost parses a host of Bitbucket Server specified as `<host>` or `<host>=<API base URL>`.
+// The token is read from `BITBUCKET_TOKEN_<HOST>` env like BITBUCKET_TOKEN_BITBUCKET_EXAMPLE_COM, then falls back to BITBUCKET_TOKEN.
+func ParseBitbucketHost(s string) (*SourceHost, error) {
+	h, err := ParseSourceHost(s, bitbucketTokenEnv)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Bitbucket host: %w", err)
+	}
+	return h, nil
+}
+
+// NewBitbucketHostsFromEnv returns Bitbucket Server hosts in BITBUCKET_HOSTS env (comma separated).
+func NewBitbucketHostsFromEnv() ([]*SourceHost, error) {
+	return NewSourceHostsFromEnv(bitbucketHostsEnv, bitbucketTokenEnv)
+}
+
+// BitbucketSource is a ReferenceSource of pull-requests in Bitbucket Server (Bitbucket Data Center).
+type BitbucketSource struct {
+	httpClient *http.Client
+	hosts      map[string]*SourceHost
+}
+
+// NewBitbucketSource creates BitbucketSource. Pull-requests are allowed only on `hosts`.
+// The REST API is accessed at https://<host>/rest/api/1.0/ unless APIBaseURL is specified.
+func NewBitbucketSource(httpClient *http.Client, hosts []*SourceHost) *BitbucketSource {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &BitbucketSource{
+		httpClient: httpClient,
+		hosts:      sourceHostsByName(hosts),
+	}
+}
+
+// Match reports whether the URL is a pull-request URL of Bitbucket Server
+// like https://bitbucket.example.com/projects/KEY/repos/repo/pull-requests/1.
+func (s *BitbucketSource) Match(ref string) bool {
+	_, err := parseBitbucketPullRequestURL(ref)
+	return err == nil
+}
+
+type bitbucketPullRequest struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// Fetch fetches the pull-request and its diff. It returns an error if the host is not allowed.
+func (s *BitbucketSource) Fetch(ctx context.Context, prURL string) (*PullRequest, error) {
+	ref, err := parseBitbucketPullRequestURL(prURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pull-request url '%s': %w", prURL, err)
+	}
+	host, ok := s.hosts[ref.Host]
+	if !ok {
+		return nil, fmt.Errorf("failed to get pull-request content '%s': Bitbucket host '%s' is not allowed", prURL, ref.Host)
+	}
+
+	header := http.Header{}
+	if host.Token != "" {
+		header.Set("Authorization", "Bearer "+host.Token)
+	}
+	prPath := fmt.Sprintf("projects/%s/repos/%s/pull-requests/%d", url.PathEscape(ref.Owner), url.PathEscape(ref.Repo), ref.Number)
+	body, _, err := sourceGet(ctx, s.httpClient, host.apiURL("/rest/api/1.0/", prPath), header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pull-request content '%s': %w", prURL, err)
+	}
+	var pr bitbucketPullRequest
+	if err := json.Unmarshal(body, &pr); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal pull-request content '%s': %w", prURL, err)
+	}
+
+	diff, _, err := sourceGet(ctx, s.httpClient, host.apiURL("/rest/api/1.0/", prPath+".diff"), header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a diff of pull-request '%s': %w", prURL, err)
+	}
+
+	return &PullRequest{
+		URL:   prURL,
+		Title: pr.Title,
+		Body:  pr.Description,
+		Diff:  string(diff),
+	}, nil
+}
+
+// parseBitbucketPullRequestURL parses the given URL and returns the host, project key (as Owner), repository slug (as Repo),
+// and ID of the pull request. A personal repository of `users/<user>` has the project key `~<user>`.
+// The host is not checked here because allowed hosts are configurable. See BitbucketSource.
+func parseBitbucketPullRequestURL(u string) (*pullRequestRef, error) {
+	parsedURL, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	// URL is like this: https://bitbucket.example.com/projects/KEY/repos/repo/pull-requests/16/overview
+	if parsedURL.Scheme != "https" {
+		return nil, fmt.Errorf("URL scheme must be https")
+	}
+	if parsedURL.Hostname() == "" {
+		return nil, fmt.Errorf("URL hostname must not be empty")
+	}
+	parts := strings.Split(strings.Trim(parsedURL.Path, "/"), "/")
+	if len(parts) < 6 || parts[2] != "repos" || parts[4] != "pull-requests" {
+		return nil, fmt.Errorf("URL format is incorrect")
+	}
+	var projectKey string
+	switch parts[0] {
+	case "projects":
+		projectKey = parts[1]
+	case "users":
+		projectKey = "~" + parts[1]
+	default:
+		return nil, fmt.Errorf("URL format is incorrect")
+	}
+	number, err := strconv.Atoi(parts[5])
+	if err != nil || number <= 0 {
+		return nil, fmt.Errorf("pull-request ID must be a positive integer: %s", parts[5])
+	}
+	return &pullRequestRef{
+		Host:   strings.ToLower(parsedURL.Hostname()),
+		Owner:  projectKey,
+		Repo:   parts[3],
+		Number: number,
+	}, nil
+}
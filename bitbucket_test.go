@@ -0,0 +1,88 @@
+package corefactorer
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func Test_parseBitbucketPullRequestURL(t *testing.T) {
+	type args struct {
+		u string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    *pullRequestRef
+		wantErr bool
+	}{
+		{
+			name: "project repository",
+			args: args{u: "https://bitbucket.example.com/projects/PRJ/repos/co-refactorer/pull-requests/1/overview"},
+			want: &pullRequestRef{Host: "bitbucket.example.com", Owner: "PRJ", Repo: "co-refactorer", Number: 1},
+		},
+		{
+			name: "personal repository",
+			args: args{u: "https://bitbucket.example.com/users/oinume/repos/co-refactorer/pull-requests/2"},
+			want: &pullRequestRef{Host: "bitbucket.example.com", Owner: "~oinume", Repo: "co-refactorer", Number: 2},
+		},
+		{
+			name:    "invalid path",
+			args:    args{u: "https://bitbucket.example.com/projects/PRJ/repos/co-refactorer/browse"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBitbucketPullRequestURL(tt.args.u)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseBitbucketPullRequestURL() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseBitbucketPullRequestURL() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_BitbucketSource_Fetch(t *testing.T) {
+	const diff = "diff --git a/a.go b/a.go\n"
+	st := &sourceFetchTest{
+		newSource: func(httpClient *http.Client, hosts []*SourceHost) ReferenceSource {
+			return NewBitbucketSource(httpClient, hosts)
+		},
+		host:       "bitbucket.example.com",
+		apiPrefix:  "/rest/api/1.0",
+		token:      "bitbucket-token",
+		authHeader: "Authorization",
+		authValue:  "Bearer bitbucket-token",
+		responses: map[string]sourceTestResponse{
+			"/rest/api/1.0/projects/PRJ/repos/co-refactorer/pull-requests/1":      {body: `{"title":"Rename","description":"Rename a function"}`},
+			"/rest/api/1.0/projects/PRJ/repos/co-refactorer/pull-requests/1.diff": {body: diff},
+		},
+		cases: []sourceFetchCase{
+			{
+				name: "ok",
+				ref:  "https://bitbucket.example.com/projects/PRJ/repos/co-refactorer/pull-requests/1/overview",
+				want: &PullRequest{
+					URL:   "https://bitbucket.example.com/projects/PRJ/repos/co-refactorer/pull-requests/1/overview",
+					Title: "Rename",
+					Body:  "Rename a function",
+					Diff:  diff,
+				},
+			},
+			{
+				name:    "not found",
+				ref:     "https://bitbucket.example.com/projects/PRJ/repos/co-refactorer/pull-requests/2",
+				wantErr: true,
+			},
+			{
+				name:    "host not allowed",
+				ref:     "https://bitbucket.example.net/projects/PRJ/repos/co-refactorer/pull-requests/1",
+				wantErr: true,
+			},
+		},
+	}
+	st.run(t)
+}
@@ -4,29 +4,72 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"os"
+	"slices"
 
 	"github.com/liushuangls/go-anthropic/v2"
 	"github.com/sashabaranov/go-openai/jsonschema"
 )
 
+const (
+	claudeProviderName = "claude"
+	// claudeDefaultMaxOutputTokens is max tokens of a response of Claude 3 models. MaxTokens is required by Claude API.
+	claudeDefaultMaxOutputTokens = 4096
+)
+
+func init() {
+	RegisterAgentProvider(&AgentProvider{
+		Name:          claudeProviderName,
+		Description:   "Anthropic Claude API",
+		ModelPrefixes: []string{"claude-"},
+		Models: []string{
+			"claude-3-5-sonnet-20240620",
+			"claude-3-opus-20240229",
+			"claude-3-sonnet-20240229",
+			"claude-3-haiku-20240307",
+		},
+		RequiredEnvs:         []string{claudeAPIKeyEnv},
+		DefaultContextWindow: 200000,
+		MaxOutputTokens: map[string]int{
+			"claude-3-5-sonnet": 8192,
+		},
+		DefaultMaxOutputTokens: claudeDefaultMaxOutputTokens,
+		CharsPerToken:          3.5,
+		New: func(model string, config *AgentConfig, logger *slog.Logger) (Agent, error) {
+			client := anthropic.NewClient(os.Getenv(config.apiKeyEnv(claudeAPIKeyEnv)))
+			return NewClaudeAgent(client, config.MaxOutputTokens, config.SystemPrompt, logger), nil
+		},
+	})
+}
+
 type ClaudeAgent struct {
-	client  *anthropic.Client
-	logger  *slog.Logger
-	model   anthropic.Model
-	toolUse *anthropic.MessageContentToolUse
+	client       *anthropic.Client
+	logger       *slog.Logger
+	model        anthropic.Model
+	maxTokens    int
+	systemPrompt string
+	toolUse      *anthropic.MessageContentToolUse
 }
 
-func NewClaudeAgent(client *anthropic.Client, logger *slog.Logger) Agent {
+// NewClaudeAgent creates ClaudeAgent. `maxTokens` is sent as max tokens of the refactoring result,
+// and claudeDefaultMaxOutputTokens is used if it's not positive.
+func NewClaudeAgent(client *anthropic.Client, maxTokens int, systemPrompt string, logger *slog.Logger) Agent {
+	if maxTokens <= 0 {
+		maxTokens = claudeDefaultMaxOutputTokens
+	}
 	return &ClaudeAgent{
-		client: client,
-		logger: logger,
+		client:       client,
+		logger:       logger,
+		maxTokens:    maxTokens,
+		systemPrompt: systemPrompt,
 	}
 }
 
 func (a *ClaudeAgent) CreateRefactoringTarget(ctx context.Context, prompt string, modelName string, temperature float32) (*RefactoringTarget, error) {
-	a.model = anthropic.Model(modelName)
+	a.model = anthropic.Model(trimProviderName(modelName, claudeProviderName))
 	resp, err := a.client.CreateMessages(ctx, anthropic.MessagesRequest{
-		Model: a.model,
+		Model:  a.model,
+		System: a.systemPrompt,
 		Messages: []anthropic.Message{
 			anthropic.NewUserTextMessage(prompt),
 		},
@@ -72,12 +115,30 @@ func (a *ClaudeAgent) CreateRefactoringTarget(ctx context.Context, prompt string
 	return target.Unique(), nil
 }
 
+func (a *ClaudeAgent) SetModel(model string, temperature float32) {
+	a.model = anthropic.Model(trimProviderName(model, claudeProviderName))
+}
+
 func (a *ClaudeAgent) CreateRefactoringResult(ctx context.Context, req *RefactoringRequest) (*RefactoringResult, error) {
 	assistanceMessage, err := req.CreateAssistanceMessage()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create assistance message: %w", err)
 	}
 
+	if a.toolUse == nil || req.ToolCallID == "" {
+		// No tool use to continue since RefactoringTarget is given explicitly
+		messages := []anthropic.Message{
+			{
+				Role: anthropic.RoleUser,
+				Content: []anthropic.MessageContent{
+					anthropic.NewTextMessageContent(req.UserPrompt),
+					anthropic.NewTextMessageContent(assistanceMessage),
+				},
+			},
+		}
+		return a.createResult(ctx, messages)
+	}
+
 	messages := []anthropic.Message{
 		anthropic.NewUserTextMessage(req.UserPrompt),
 		{
@@ -88,14 +149,56 @@ func (a *ClaudeAgent) CreateRefactoringResult(ctx context.Context, req *Refactor
 		},
 		anthropic.NewToolResultsMessage(req.ToolCallID, assistanceMessage, false),
 	}
+	return a.createResult(ctx, messages)
+}
+
+func (a *ClaudeAgent) RepairRefactoringResult(ctx context.Context, req *RepairRequest) (*RefactoringResult, error) {
+	conversation, ok := req.Previous.conversation.([]anthropic.Message)
+	if !ok || len(conversation) == 0 {
+		return nil, errNoConversation
+	}
+	repairMessage, err := req.CreateRepairMessage()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create repair message: %w", err)
+	}
+
+	// Every tool use must be responded with a tool result
+	var contents []anthropic.MessageContent
+	for _, c := range conversation[len(conversation)-1].Content {
+		if c.Type != anthropic.MessagesContentTypeToolUse {
+			continue
+		}
+		content := repairMessage
+		if len(contents) > 0 {
+			content = "See the first tool result"
+		}
+		contents = append(contents, anthropic.NewToolResultMessageContent(c.MessageContentToolUse.ID, content, true))
+	}
+	if len(contents) == 0 {
+		contents = append(contents, anthropic.NewTextMessageContent(repairMessage))
+	}
+	messages := append(slices.Clone(conversation), anthropic.Message{
+		Role:    anthropic.RoleUser,
+		Content: contents,
+	})
+	return a.createResult(ctx, messages)
+}
+
+// createResult sends the messages and receives RefactoringResult through `submitRefactoringResult` tool.
+func (a *ClaudeAgent) createResult(ctx context.Context, messages []anthropic.Message) (*RefactoringResult, error) {
 	a.logger.Debug("API call: a.client.CreateMessages")
 	resp, err := a.client.CreateMessages(
 		ctx,
 		anthropic.MessagesRequest{
-			MaxTokens: 4096,
+			MaxTokens: a.maxTokens,
 			Model:     a.model,
+			System:    a.systemPrompt,
 			Messages:  messages,
-			Tools:     []anthropic.ToolDefinition{a.getTool()},
+			Tools:     []anthropic.ToolDefinition{a.getTool(), a.getResultTool()},
+			ToolChoice: &anthropic.ToolChoice{
+				Type: "tool",
+				Name: resultFunctionName,
+			},
 		},
 	)
 	if err != nil {
@@ -105,13 +208,29 @@ func (a *ClaudeAgent) CreateRefactoringResult(ctx context.Context, req *Refactor
 		return nil, fmt.Errorf("no content in response")
 	}
 
+	result := &RefactoringResult{
+		conversation: append(slices.Clip(messages), anthropic.Message{
+			Role:    anthropic.RoleAssistant,
+			Content: resp.Content,
+		}),
+	}
 	for i, c := range resp.Content {
 		a.logger.Debug("CreateMessages response", slog.Int("index", i), slog.Any("content", c))
+		switch c.Type {
+		case anthropic.MessagesContentTypeText:
+			result.RawContent += c.GetText()
+		case anthropic.MessagesContentTypeToolUse:
+			if c.MessageContentToolUse.Name != resultFunctionName {
+				continue
+			}
+			files, err := parseResultFunctionArguments(c.MessageContentToolUse.Input)
+			if err != nil {
+				return nil, err
+			}
+			result.Files = append(result.Files, files...)
+		}
 	}
-
-	return &RefactoringResult{
-		RawContent: resp.Content[0].GetText(),
-	}, nil
+	return result, nil
 }
 
 func (a *ClaudeAgent) getTool() anthropic.ToolDefinition {
@@ -141,3 +260,11 @@ func (a *ClaudeAgent) getTool() anthropic.ToolDefinition {
 	}
 	return tool
 }
+
+func (a *ClaudeAgent) getResultTool() anthropic.ToolDefinition {
+	return anthropic.ToolDefinition{
+		Name:        resultFunctionName,
+		Description: resultFunctionDescription,
+		InputSchema: resultFunctionParameters(),
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/oinume/corefactorer"
+)
+
+// loadConfig loads the user-level configuration file and the project configuration files at the root of the repository
+// and in the current directory. The project configuration takes precedence.
+func (c *cli) loadConfig() (*corefactorer.Config, error) {
+	userConfigPath, err := corefactorer.UserConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	projectConfigPaths, err := corefactorer.ProjectConfigPaths(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return corefactorer.LoadConfig(append([]string{userConfigPath}, projectConfigPaths...)...)
+}
+
+// applyConfig loads the configuration and applies it to the options after the flags are parsed. Flags specified
+// explicitly take precedence over the configuration, and hosts in the configuration are added before hosts in the flags.
+func (c *cli) applyConfig(flagSet *flag.FlagSet, o *options) error {
+	config, err := c.loadConfig()
+	if err != nil {
+		return err
+	}
+	o.mergeConfig(config, flagSet)
+	return nil
+}
+
+func (o *options) mergeConfig(config *corefactorer.Config, flagSet *flag.FlagSet) {
+	specified := make(map[string]bool)
+	flagSet.Visit(func(f *flag.Flag) {
+		specified[f.Name] = true
+	})
+	// A value is applied only if the subcommand registers the flag, so that a subcommand like apply, which can't repair
+	// without LLM, doesn't get max_repair_attempts.
+	configurable := func(name string) bool {
+		return flagSet.Lookup(name) != nil && !specified[name]
+	}
+
+	if config.Model != "" && configurable("model") {
+		o.model = config.Model
+	}
+	if config.Temperature != nil && configurable("temperature") {
+		o.temperature = *config.Temperature
+	}
+	if config.ContextWindow != nil && configurable("context-window") {
+		o.contextWindow = *config.ContextWindow
+	}
+	if config.Verify != nil && configurable("verify") {
+		o.verify = *config.Verify
+	}
+	if len(config.VerifyCommands) > 0 && configurable("verify-cmd") {
+		o.verifyCmds = config.VerifyCommands
+	}
+	if config.MaxRepairAttempts != nil && configurable("max-repair-attempts") {
+		o.maxRepairAttempts = *config.MaxRepairAttempts
+	}
+	if config.Lang != "" && configurable("lang") {
+		o.lang = config.Lang
+	}
+	if config.PromptTemplate != "" && configurable("prompt-template") {
+		o.promptTemplate = config.PromptTemplate
+	}
+	if config.StyleGuide != "" && configurable("style-guide") {
+		o.styleGuide = config.StyleGuide
+	}
+	o.referenceHosts.addConfig(config)
+	o.excludePaths = config.ExcludePaths
+	o.apiKeyEnvs = config.APIKeyEnvs
+}
+
+// addConfig adds hosts in the configuration before hosts in the flags.
+func (f *referenceHostFlags) addConfig(config *corefactorer.Config) {
+	f.github = append(append(stringsFlag{}, config.GitHubHosts...), f.github...)
+	f.gitlab = append(append(stringsFlag{}, config.GitLabHosts...), f.gitlab...)
+	f.gitea = append(append(stringsFlag{}, config.GiteaHosts...), f.gitea...)
+	f.bitbucket = append(append(stringsFlag{}, config.BitbucketHosts...), f.bitbucket...)
+}
+
+// runConfig runs subcommands of the configuration. Only `show` is supported.
+func (c *cli) runConfig(args []string) int {
+	if len(args) == 0 || args[0] != "show" {
+		_, _ = fmt.Fprintf(c.err, "Usage: co-refactorer config show\n")
+		return ExitError
+	}
+	return c.runConfigShow()
+}
+
+// runConfigShow prints the loaded configuration files and the merged configuration in YAML.
+func (c *cli) runConfigShow() int {
+	config, err := c.loadConfig()
+	if err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+	if len(config.Files) == 0 {
+		_, _ = fmt.Fprintln(c.out, "# No configuration files are loaded")
+	}
+	for _, f := range config.Files {
+		_, _ = fmt.Fprintf(c.out, "# Loaded from %s\n", f)
+	}
+	content, err := config.YAML()
+	if err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+	_, _ = fmt.Fprint(c.out, content)
+	return ExitOK
+}
@@ -8,15 +8,17 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"strings"
 
-	"github.com/google/go-github/v65/github"
 	"github.com/oinume/corefactorer"
-	"github.com/sashabaranov/go-openai"
 )
 
 const (
 	ExitOK    = 0
 	ExitError = 1
+
+	outputApply = "apply"
+	outputDiff  = "diff"
 )
 
 type cli struct {
@@ -31,7 +33,7 @@ func newCLI(in io.Reader, out, err io.Writer) *cli {
 		in:     in,
 		out:    out,
 		err:    err,
-		logger: createLogger(out),
+		logger: createLogger(err),
 	}
 }
 
@@ -41,73 +43,141 @@ func main() {
 }
 
 func (c *cli) run(args []string) int {
-	flagSet := flag.NewFlagSet("co-refactorer", flag.ContinueOnError)
+	if len(args) > 1 {
+		switch args[1] {
+		case "models":
+			return c.runModels()
+		case "config":
+			return c.runConfig(args[2:])
+		case "discover":
+			return c.runDiscover(args[2:])
+		case "plan":
+			return c.runPlan(args[2:])
+		case "fetch":
+			return c.runFetch(args[2:])
+		case "generate":
+			return c.runGenerate(args[2:])
+		case "apply":
+			return c.runApply(args[2:])
+		case "run":
+			return c.runPipeline("co-refactorer run", args[2:])
+		}
+	}
+	// Run the whole pipeline without a subcommand for compatibility
+	return c.runPipeline("co-refactorer", args[1:])
+}
+
+// exitCode returns ExitError if any request failed, reporting how many requests failed.
+func (c *cli) exitCode(failed int, total int) int {
+	if failed == 0 {
+		return ExitOK
+	}
+	if total > 1 {
+		c.outputError(fmt.Errorf("%d of %d requests failed", failed, total))
+	}
+	return ExitError
+}
+
+// runModels lists registered agent providers and their known models.
+func (c *cli) runModels() int {
+	for i, p := range corefactorer.AgentProviders() {
+		if i > 0 {
+			_, _ = fmt.Fprintln(c.out)
+		}
+		prefixes := append([]string{p.Name + "/"}, p.ModelPrefixes...)
+		requiredEnvs := "-"
+		if len(p.RequiredEnvs) > 0 {
+			requiredEnvs = strings.Join(p.RequiredEnvs, ", ")
+		}
+		_, _ = fmt.Fprintf(c.out, "%s: %s\n", p.Name, p.Description)
+		_, _ = fmt.Fprintf(c.out, "  model prefixes: %s\n", strings.Join(prefixes, ", "))
+		_, _ = fmt.Fprintf(c.out, "  required envs: %s\n", requiredEnvs)
+		_, _ = fmt.Fprintf(c.out, "  known models:\n")
+		for _, m := range p.Models {
+			_, _ = fmt.Fprintf(c.out, "    %s\n", m)
+		}
+	}
+	return ExitOK
+}
+
+// runDiscover proposes files which contain code similar to the removed side of the references.
+// The files are printed with their scores so that the user can review them before adding them to the prompt.
+func (c *cli) runDiscover(args []string) int {
+	flagSet := flag.NewFlagSet("co-refactorer discover", flag.ContinueOnError)
 	flagSet.SetOutput(c.err)
+	flagSet.Usage = func() {
+		_, _ = fmt.Fprintf(c.err, "Usage: co-refactorer discover [flags] <pull-request URL, git:<revision> or patch file>...\n")
+		flagSet.PrintDefaults()
+	}
 	var (
-		flagPrompt      = flagSet.String("prompt", "", "Prompt for LLM")
-		flagPromptFile  = flagSet.String("prompt-file", "", "Specify prompt file for LLM")
-		flagModel       = flagSet.String("model", openai.GPT4oMini, "Specify LLM model of OpenAI. Available models: gpt-4o, gpt-4o-mini, etc...")
-		flagTemperature = flagSet.Float64("temperature", 0.7, "Specify temperature for LLM")
+		flagPaths          stringsFlag
+		flagMinScore       = flagSet.Float64("min-score", corefactorer.DefaultDiscoverMinScore, "Specify minimum ratio (0-1) of the removed lines of the references found in a proposed file")
+		flagState          = flagSet.String("state", "", "Specify a path of state file to save the references and the discovered files as the target. Edit it and run `co-refactorer fetch` to continue")
+		flagInstruction    = flagSet.String("instruction", "", "Instruction for LLM saved in the state file with -state")
+		flagReferenceHosts referenceHostFlags
 	)
-	if err := flagSet.Parse(args[1:]); err != nil {
+	flagSet.Var(&flagPaths, "path", "Specify a directory, a glob pattern or a Go package pattern to search files. Can be specified multiple times (default: current directory)")
+	flagReferenceHosts.register(flagSet)
+	if err := flagSet.Parse(args); err != nil {
+		return ExitError
+	}
+	if flagSet.NArg() == 0 {
 		flagSet.Usage()
 		return ExitError
 	}
-
-	prompt, err := c.getPrompt(flagPrompt, flagPromptFile)
+	config, err := c.loadConfig()
 	if err != nil {
 		c.outputError(err)
 		return ExitError
 	}
-	c.logger.Debug("prompt", slog.String("prompt", prompt))
+	flagReferenceHosts.addConfig(config)
 
-	agent, err := corefactorer.NewAgent(*flagModel, c.logger)
+	httpClient := http.DefaultClient
+	referenceSources, err := createReferenceSources(httpClient, &flagReferenceHosts, false)
 	if err != nil {
 		c.outputError(err)
 		return ExitError
 	}
-	c.logger.Debug("Agent created")
-	githubClient := createGitHubClient(nil)
-	httpClient := http.DefaultClient
-	app := corefactorer.New(c.logger, agent, githubClient, httpClient)
-	c.logger.Debug("App created")
-
-	ctx := context.Background()
-	target, err := app.CreateRefactoringTarget(ctx, prompt, *flagModel, float32(*flagTemperature))
+	app := corefactorer.New(c.logger, nil, referenceSources, httpClient)
+	discovered, err := app.DiscoverTargetFiles(context.Background(), flagSet.Args(), flagPaths, config.ExcludePaths, *flagMinScore)
 	if err != nil {
 		c.outputError(err)
 		return ExitError
 	}
-	c.logger.Debug("CreateRefactoringTarget succeeded", slog.Any("target", target))
-
-	if err := target.Validate(); err != nil {
-		c.outputError(err)
-		return ExitError
+	if len(discovered) == 0 {
+		c.logger.Info("No files similar to the references are found")
+		return ExitOK
 	}
-
-	request, err := app.CreateRefactoringRequest(ctx, target)
-	if err != nil {
-		c.outputError(err)
-		return ExitError
+	paths := make([]string, len(discovered))
+	for i, f := range discovered {
+		_, _ = fmt.Fprintf(c.out, "%s\t%.2f\n", f.Path, f.Score)
+		paths[i] = f.Path
 	}
-	c.logger.Debug("CreateRefactoringRequest succeeded", slog.Any("request", request))
-
-	result, err := app.CreateRefactoringResult(ctx, request)
-	if err != nil {
-		c.outputError(err)
-		return ExitError
+	if *flagState == "" {
+		c.logger.Info(fmt.Sprintf("%d files are discovered. Review them and add them to the prompt as target files", len(discovered)))
+		return ExitOK
 	}
-	c.logger.Debug("CreateRefactoringResult succeeded", slog.Any("result.RawContent", result.RawContent))
-
-	if err := app.ApplyRefactoringResult(ctx, result); err != nil {
+	target := corefactorer.NewRefactoringTarget(*flagInstruction, flagSet.Args(), paths)
+	if err := (&corefactorer.State{Target: target}).Save(*flagState); err != nil {
 		c.outputError(err)
 		return ExitError
 	}
-	c.logger.Debug("ApplyRefactoringResult succeeded")
-
+	c.logger.Info(fmt.Sprintf("%d files are discovered and saved to %s. Review them and run `co-refactorer fetch -state=%s`", len(discovered), *flagState, *flagState))
 	return ExitOK
 }
 
+// stringsFlag is a flag.Value which can be specified multiple times.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
 func createLogger(out io.Writer) *slog.Logger {
 	logLevel := slog.LevelInfo
 	if os.Getenv("DEBUG") == "true" {
@@ -116,13 +186,78 @@ func createLogger(out io.Writer) *slog.Logger {
 	return slog.New(slog.NewTextHandler(out, &slog.HandlerOptions{Level: logLevel}))
 }
 
-func createGitHubClient(httpClient *http.Client) *github.Client {
-	c := github.NewClient(httpClient)
-	token := os.Getenv("GITHUB_TOKEN")
-	if token != "" {
-		c = c.WithAuthToken(token)
+// referenceHostFlags are hosts of reference sources specified with flags.
+type referenceHostFlags struct {
+	github    stringsFlag
+	gitlab    stringsFlag
+	gitea     stringsFlag
+	bitbucket stringsFlag
+}
+
+func (f *referenceHostFlags) register(flagSet *flag.FlagSet) {
+	flagSet.Var(&f.github, "github-host", "Specify a GitHub Enterprise Server host allowed in pull-request URLs as '<host>' or '<host>=<API base URL>'. Can be specified multiple times")
+	flagSet.Var(&f.gitlab, "gitlab-host", "Specify a self-managed GitLab host allowed in merge request URLs as '<host>' or '<host>=<API base URL>'. Can be specified multiple times")
+	flagSet.Var(&f.gitea, "gitea-host", "Specify a Gitea host allowed in pull-request URLs as '<host>' or '<host>=<API base URL>'. Can be specified multiple times")
+	flagSet.Var(&f.bitbucket, "bitbucket-host", "Specify a Bitbucket Server host allowed in pull-request URLs as '<host>' or '<host>=<API base URL>'. Can be specified multiple times")
+}
+
+func createReferenceSources(httpClient *http.Client, flags *referenceHostFlags, includeComments bool) ([]corefactorer.ReferenceSource, error) {
+	githubHosts, err := corefactorer.NewGitHubHostsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range flags.github {
+		host, err := corefactorer.ParseGitHubHost(h)
+		if err != nil {
+			return nil, err
+		}
+		githubHosts = append(githubHosts, host)
+	}
+	githubClients, err := corefactorer.NewGitHubClients(httpClient, githubHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	gitlabHosts, err := sourceHosts(corefactorer.NewGitLabHostsFromEnv, corefactorer.ParseGitLabHost, flags.gitlab)
+	if err != nil {
+		return nil, err
+	}
+	giteaHosts, err := sourceHosts(corefactorer.NewGiteaHostsFromEnv, corefactorer.ParseGiteaHost, flags.gitea)
+	if err != nil {
+		return nil, err
+	}
+	bitbucketHosts, err := sourceHosts(corefactorer.NewBitbucketHostsFromEnv, corefactorer.ParseBitbucketHost, flags.bitbucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return []corefactorer.ReferenceSource{
+		corefactorer.NewGitHubSource(githubClients, includeComments),
+		corefactorer.NewGitLabSource(httpClient, gitlabHosts),
+		corefactorer.NewGiteaSource(httpClient, giteaHosts),
+		corefactorer.NewBitbucketSource(httpClient, bitbucketHosts),
+		corefactorer.NewGitSource(""),
+	}, nil
+}
+
+// sourceHosts returns hosts from env followed by hosts from flags.
+func sourceHosts(
+	fromEnv func() ([]*corefactorer.SourceHost, error),
+	parse func(string) (*corefactorer.SourceHost, error),
+	flagHosts []string,
+) ([]*corefactorer.SourceHost, error) {
+	hosts, err := fromEnv()
+	if err != nil {
+		return nil, err
 	}
-	return c
+	for _, h := range flagHosts {
+		host, err := parse(h)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
 }
 
 func (c *cli) getPrompt(query *string, queryFile *string) (string, error) {
@@ -151,6 +286,22 @@ func (c *cli) getPrompt(query *string, queryFile *string) (string, error) {
 	return queryContent, nil
 }
 
+// isColorEnabled returns true if the output is a terminal and NO_COLOR is not defined.
+func (c *cli) isColorEnabled() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := c.out.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
 func (c *cli) outputError(err error) {
 	_, _ = fmt.Fprintln(c.err, err.Error())
 }
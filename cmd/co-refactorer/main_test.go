@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/oinume/corefactorer"
+)
+
+func Test_cli_runDiscover_State(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	content := "package a\n\nfunc A() error {\n\treturn errors.New(\"failed to do something\")\n}\n"
+	writeFiles(t, dir, map[string]string{
+		"change.patch": `diff --git a/x.go b/x.go
+--- a/x.go
++++ b/x.go
+@@ -1,3 +1,3 @@
+ func X() error {
+-	return errors.New("failed to do something else")
++	return fmt.Errorf("failed to do something else: %w", err)
+ }
+`,
+		"a.go":                      content,
+		"internal/b.go":             content,
+		corefactorer.ConfigFileName: "exclude_paths: ['internal/**']\n",
+	})
+
+	var stdout, stderr bytes.Buffer
+	c := newCLI(strings.NewReader(""), &stdout, &stderr)
+	args := []string{"co-refactorer", "discover", "-path=./...", "-state=state.json", "-instruction=Wrap errors", "change.patch"}
+	if got := c.run(args); got != ExitOK {
+		t.Fatalf("run() = %d, want %d: %s", got, ExitOK, stderr.String())
+	}
+	if got, want := stdout.String(), "a.go\t1.00\n"; got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+	state, err := corefactorer.LoadState("state.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &corefactorer.RefactoringTarget{
+		UserPrompt:      "Wrap errors",
+		PullRequestURLs: []string{"change.patch"},
+		Files:           []string{"a.go"},
+	}
+	if !reflect.DeepEqual(state.Target, want) {
+		t.Errorf("state.Target = %+v, want %+v", state.Target, want)
+	}
+}
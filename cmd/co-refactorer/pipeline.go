@@ -0,0 +1,724 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/oinume/corefactorer"
+	"github.com/sashabaranov/go-openai"
+)
+
+// options are flag values of the refactoring pipeline. Each subcommand registers the flags of the steps it runs.
+type options struct {
+	statePath string
+
+	// config has no flags
+	excludePaths []string
+	apiKeyEnvs   map[string]string
+	// project is loaded lazily by projectInfo
+	project *corefactorer.ProjectInfo
+
+	// plan
+	prompt        string
+	promptFile    string
+	instruction   string
+	prs           stringsFlag
+	files         stringsFlag
+	allowNewFiles stringsFlag
+
+	// model
+	model            string
+	systemPrompt     bool
+	temperature      float64
+	contextWindow    int
+	openAIBaseURL    string
+	openAIAPIType    string
+	openAIAPIVersion string
+	azureDeployment  string
+	openAIHeaders    stringsFlag
+
+	// fetch
+	referenceHosts    referenceHostFlags
+	diffIncludes      stringsFlag
+	diffExcludes      stringsFlag
+	diffKeepGenerated bool
+	prComments        bool
+
+	// generate
+	perFile        bool
+	workers        int
+	lang           string
+	promptTemplate string
+	styleGuide     string
+
+	// apply
+	dryRun            bool
+	output            string
+	verify            bool
+	verifyCmds        stringsFlag
+	maxRepairAttempts int
+	force             bool
+}
+
+func newFlagSet(c *cli, name string) *flag.FlagSet {
+	flagSet := flag.NewFlagSet(name, flag.ContinueOnError)
+	flagSet.SetOutput(c.err)
+	return flagSet
+}
+
+func (o *options) registerStateFlag(flagSet *flag.FlagSet, defaultPath string, usage string) {
+	flagSet.StringVar(&o.statePath, "state", defaultPath, usage)
+}
+
+func (o *options) registerPlanFlags(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&o.prompt, "prompt", "", "Prompt for LLM")
+	flagSet.StringVar(&o.promptFile, "prompt-file", "", "Specify prompt file for LLM")
+	flagSet.StringVar(&o.instruction, "instruction", "", "Instruction for LLM used with -pr and -file. The prompt is used as the instruction if it's empty")
+	flagSet.Var(&o.prs, "pr", "Specify a pull-request URL or a reference to refer to. Extracting it from the prompt with LLM is skipped if -pr or -file is specified. Can be specified multiple times")
+	flagSet.Var(&o.files, "file", "Specify a target file, a glob pattern, a directory or a Go package pattern to be refactored. Extracting it from the prompt with LLM is skipped if -pr or -file is specified. Can be specified multiple times")
+	flagSet.Var(&o.allowNewFiles, "allow-new-file", "Specify a file which is allowed to be created by the refactoring. Can be specified multiple times")
+}
+
+func (o *options) registerModelFlags(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&o.model, "model", openai.GPT4oMini, "Specify LLM model. Available models: gpt-4o, gpt-4o-mini, claude-3-5-sonnet-20240620, gemini-1.5-pro, ollama/<model>, etc... Run `co-refactorer models` to list known models")
+	flagSet.Float64Var(&o.temperature, "temperature", 0.7, "Specify temperature for LLM")
+	flagSet.BoolVar(&o.systemPrompt, "system-prompt", true, "Send a system prompt with the conventions of the project found in go.mod, .golangci.yml, CONTRIBUTING.md and .editorconfig")
+	flagSet.IntVar(&o.contextWindow, "context-window", 0, "Specify context window of the model in tokens. The known context window of the model is used if 0")
+	flagSet.StringVar(&o.openAIBaseURL, "openai-base-url", "", "Specify base URL of OpenAI-compatible API (vLLM, LiteLLM, LocalAI, Azure OpenAI endpoint, etc...)")
+	flagSet.StringVar(&o.openAIAPIType, "openai-api-type", "", "Specify API type of OpenAI-compatible API: openai or azure")
+	flagSet.StringVar(&o.openAIAPIVersion, "openai-api-version", "", "Specify API version of OpenAI-compatible API. Required for Azure OpenAI")
+	flagSet.StringVar(&o.azureDeployment, "azure-deployment", "", "Specify deployment name of Azure OpenAI")
+	flagSet.Var(&o.openAIHeaders, "openai-header", "Specify extra HTTP header sent to OpenAI-compatible API as 'Key: Value' format. Can be specified multiple times")
+}
+
+func (o *options) registerFetchFlags(flagSet *flag.FlagSet) {
+	o.referenceHosts.register(flagSet)
+	flagSet.Var(&o.diffIncludes, "diff-include", "Specify a glob pattern like '**/*.go' of files kept in diffs of pull-requests. Other files are dropped. Can be specified multiple times")
+	flagSet.Var(&o.diffExcludes, "diff-exclude", "Specify a glob pattern like 'docs/**' of files dropped from diffs of pull-requests. Can be specified multiple times")
+	flagSet.BoolVar(&o.diffKeepGenerated, "diff-keep-generated", false, "Keep generated files, lock files (go.sum, package-lock.json, etc...) and vendored files in diffs of pull-requests. They are dropped by default")
+	flagSet.BoolVar(&o.prComments, "pr-comments", true, "Include review comments and issue comments of GitHub pull-requests in the prompt. Disable it for very long threads")
+}
+
+func (o *options) registerGenerateFlags(flagSet *flag.FlagSet) {
+	flagSet.BoolVar(&o.perFile, "per-file", false, "Send a request per target file sharing the same pull-request context. Requests are sent concurrently")
+	flagSet.IntVar(&o.workers, "workers", 4, "Specify max number of requests sent to LLM concurrently")
+	flagSet.StringVar(&o.lang, "lang", corefactorer.DefaultPromptLanguage, fmt.Sprintf("Specify language of the built-in prompt template: %s", strings.Join(corefactorer.PromptLanguages(), " or ")))
+	flagSet.StringVar(&o.promptTemplate, "prompt-template", "", "Specify a template file of the prompt to override the built-in prompt template")
+	flagSet.StringVar(&o.styleGuide, "style-guide", "", "Specify a style guide file of the project included in the prompt")
+}
+
+// registerApplyFlags registers the flags of apply step. `-max-repair-attempts` is registered only if `repair` is true
+// since repairing requires the conversation with LLM in the same process.
+func (o *options) registerApplyFlags(flagSet *flag.FlagSet, repair bool) {
+	flagSet.BoolVar(&o.dryRun, "dry-run", false, "Print a unified diff of the refactoring instead of overwriting files. Same as -output=diff")
+	flagSet.StringVar(&o.output, "output", outputApply, "Specify output mode: apply (overwrite files) or diff (print a unified diff)")
+	flagSet.BoolVar(&o.verify, "verify", true, "Verify refactored Go files with go/parser and goimports after applying, and restore the original files if it fails")
+	flagSet.BoolVar(&o.force, "force", false, "Overwrite files which are modified after the fetch step. Applying is refused for them by default since the modification would be reverted")
+	flagSet.Var(&o.verifyCmds, "verify-cmd", "Specify a command to verify the refactoring like 'go build ./...' or 'go test {packages}'. {packages} is replaced with the affected packages. Can be specified multiple times")
+	if repair {
+		flagSet.IntVar(&o.maxRepairAttempts, "max-repair-attempts", 2, "Specify max number of attempts to ask LLM to fix the refactoring when the verification fails")
+	}
+}
+
+// outputMode returns the output mode of apply step.
+func (o *options) outputMode() (string, error) {
+	output := o.output
+	if o.dryRun {
+		output = outputDiff
+	}
+	if output != outputApply && output != outputDiff {
+		return "", fmt.Errorf("unknown output mode '%s': must be %s or %s", output, outputApply, outputDiff)
+	}
+	return output, nil
+}
+
+func (o *options) diffFilter() (*corefactorer.DiffFilter, error) {
+	diffFilter := &corefactorer.DiffFilter{
+		Include:       o.diffIncludes,
+		Exclude:       append(append([]string{}, o.diffExcludes...), o.excludePaths...),
+		KeepGenerated: o.diffKeepGenerated,
+	}
+	if err := diffFilter.Validate(); err != nil {
+		return nil, err
+	}
+	return diffFilter, nil
+}
+
+// setPromptOptions sets the prompt template, the language and the project information to the request.
+func (o *options) setPromptOptions(request *corefactorer.RefactoringRequest) error {
+	if _, err := corefactorer.BuiltinPromptTemplate(o.lang); err != nil {
+		return err
+	}
+	request.Language = o.lang
+	if o.promptTemplate != "" {
+		promptTemplate, err := corefactorer.LoadPromptTemplate(o.promptTemplate)
+		if err != nil {
+			return err
+		}
+		request.PromptTemplate = promptTemplate
+	}
+	project, err := o.projectInfo()
+	if err != nil {
+		return err
+	}
+	request.Project = project
+	return nil
+}
+
+// createSystemPrompt returns the system prompt with the conventions of the project. It's empty if -system-prompt is false.
+func (o *options) createSystemPrompt() (string, error) {
+	if !o.systemPrompt {
+		return "", nil
+	}
+	project, err := o.projectInfo()
+	if err != nil {
+		return "", err
+	}
+	return corefactorer.CreateSystemPrompt(project)
+}
+
+// projectInfo loads the project information in the current directory once.
+func (o *options) projectInfo() (*corefactorer.ProjectInfo, error) {
+	if o.project != nil {
+		return o.project, nil
+	}
+	project, err := corefactorer.LoadProjectInfo(".", o.styleGuide)
+	if err != nil {
+		return nil, err
+	}
+	o.project = project
+	return project, nil
+}
+
+// explicitTarget reports whether the target is given with -pr and -file flags instead of the prompt.
+func (o *options) explicitTarget() (bool, error) {
+	explicit := len(o.prs) > 0 || len(o.files) > 0
+	if explicit && len(o.files) == 0 {
+		return false, fmt.Errorf("-file is required when -pr is specified")
+	}
+	return explicit, nil
+}
+
+func (c *cli) newAgent(o *options) (corefactorer.Agent, error) {
+	openAIConfig, err := corefactorer.NewOpenAIConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if o.openAIBaseURL != "" {
+		openAIConfig.BaseURL = o.openAIBaseURL
+	}
+	if o.openAIAPIType != "" {
+		openAIConfig.APIType = o.openAIAPIType
+	}
+	if o.openAIAPIVersion != "" {
+		openAIConfig.APIVersion = o.openAIAPIVersion
+	}
+	if o.azureDeployment != "" {
+		openAIConfig.Deployment = o.azureDeployment
+	}
+	for _, h := range o.openAIHeaders {
+		if err := openAIConfig.AddHeader(h); err != nil {
+			return nil, err
+		}
+	}
+
+	agentConfig := &corefactorer.AgentConfig{
+		OpenAI:        openAIConfig,
+		ContextWindow: o.contextWindow,
+	}
+	if provider, err := corefactorer.FindAgentProvider(o.model); err == nil {
+		agentConfig.APIKeyEnv = o.apiKeyEnvs[provider.Name]
+	}
+	systemPrompt, err := o.createSystemPrompt()
+	if err != nil {
+		return nil, err
+	}
+	agentConfig.SystemPrompt = systemPrompt
+	c.logger.Debug("System prompt", slog.String("systemPrompt", systemPrompt))
+	agent, err := corefactorer.NewAgent(o.model, agentConfig, c.logger)
+	if err != nil {
+		return nil, err
+	}
+	c.logger.Debug("Agent created")
+	return agent, nil
+}
+
+// newApp creates App. `agent` can be nil for the steps which don't use LLM.
+func (c *cli) newApp(o *options, agent corefactorer.Agent) (*corefactorer.App, error) {
+	httpClient := http.DefaultClient
+	referenceSources, err := createReferenceSources(httpClient, &o.referenceHosts, o.prComments)
+	if err != nil {
+		return nil, err
+	}
+	app := corefactorer.New(c.logger, agent, referenceSources, httpClient)
+	c.logger.Debug("App created")
+	return app, nil
+}
+
+// plan creates RefactoringTarget from the flags, or from the prompt with LLM.
+// `app` is used only when the target is not given with the flags.
+func (c *cli) plan(ctx context.Context, o *options, app *corefactorer.App) (*corefactorer.RefactoringTarget, error) {
+	explicit, err := o.explicitTarget()
+	if err != nil {
+		return nil, err
+	}
+	prompt := o.instruction
+	if prompt == "" {
+		prompt, err = c.getPrompt(&o.prompt, &o.promptFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.logger.Debug("prompt", slog.String("prompt", prompt))
+
+	var target *corefactorer.RefactoringTarget
+	if explicit {
+		target = corefactorer.NewRefactoringTarget(prompt, o.prs, o.files)
+		c.logger.Debug("NewRefactoringTarget succeeded", slog.Any("target", target))
+	} else {
+		target, err = app.CreateRefactoringTarget(ctx, prompt, o.model, float32(o.temperature))
+		if err != nil {
+			return nil, err
+		}
+		c.logger.Debug("CreateRefactoringTarget succeeded", slog.Any("target", target))
+	}
+
+	target.NewFiles = append(target.NewFiles, o.allowNewFiles...)
+	skippedFiles, err := target.ExpandFiles(ctx, o.excludePaths)
+	if err != nil {
+		return nil, err
+	}
+	for _, skipped := range skippedFiles {
+		c.logger.Info("Skipped from the target files: " + skipped.String())
+	}
+	target = target.Unique()
+	if err := target.Validate(); err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// fetch creates RefactoringRequest by fetching the pull-requests and the target files, and filters the diffs.
+func (c *cli) fetch(ctx context.Context, o *options, app *corefactorer.App, target *corefactorer.RefactoringTarget) (*corefactorer.RefactoringRequest, error) {
+	diffFilter, err := o.diffFilter()
+	if err != nil {
+		return nil, err
+	}
+	request, err := app.CreateRefactoringRequest(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	for _, dropped := range request.FilterDiffs(diffFilter) {
+		c.logger.Info("Dropped from the diff: " + dropped.String())
+	}
+	c.logger.Debug("CreateRefactoringRequest succeeded", slog.Any("request", request))
+	return request, nil
+}
+
+// generate splits the request per file or to fit in the context window, and sends the requests to LLM concurrently.
+// Failed requests are reported and returned in the outcomes so that they don't lose the results of the other requests.
+func (c *cli) generate(ctx context.Context, o *options, app *corefactorer.App, request *corefactorer.RefactoringRequest) ([]*corefactorer.RefactoringOutcome, error) {
+	provider, err := corefactorer.FindAgentProvider(o.model)
+	if err != nil {
+		return nil, err
+	}
+	budget := provider.TokenBudget(o.model, o.contextWindow)
+	systemPrompt, err := o.createSystemPrompt()
+	if err != nil {
+		return nil, err
+	}
+	budget.SystemPromptTokens = budget.EstimateTokens(systemPrompt)
+	if err := o.setPromptOptions(request); err != nil {
+		return nil, err
+	}
+	baseRequests := []*corefactorer.RefactoringRequest{request}
+	if o.perFile {
+		baseRequests = request.SplitPerFile()
+	}
+	var requests []*corefactorer.RefactoringRequest
+	for _, req := range baseRequests {
+		fitted, droppedDiffs, err := req.FitToBudget(budget)
+		if err != nil {
+			return nil, err
+		}
+		for _, dropped := range droppedDiffs {
+			c.logger.Info("Dropped from the diff: " + dropped.String())
+		}
+		requests = append(requests, fitted...)
+	}
+	if !o.perFile && len(requests) > 1 {
+		c.logger.Info(fmt.Sprintf("The target files are split into %d requests to fit in the context window", len(requests)))
+	}
+
+	outcomes := app.CreateRefactoringResults(ctx, requests, o.workers)
+	for _, outcome := range outcomes {
+		if outcome.Err != nil {
+			c.outputError(fmt.Errorf("failed to refactor %s: %w", strings.Join(outcome.Request.TargetPaths(), ", "), outcome.Err))
+			continue
+		}
+		c.logger.Debug("CreateRefactoringResult succeeded", slog.Any("result.RawContent", outcome.Result.RawContent))
+	}
+	return outcomes, nil
+}
+
+// apply prints a diff of the results or applies them and verifies the applied files.
+// It returns the number of the requests which failed to apply or verify. Failed outcomes of generate step are skipped.
+func (c *cli) apply(ctx context.Context, o *options, app *corefactorer.App, outcomes []*corefactorer.RefactoringOutcome) (int, error) {
+	output, err := o.outputMode()
+	if err != nil {
+		return 0, err
+	}
+	var succeeded []*corefactorer.RefactoringOutcome
+	for _, outcome := range outcomes {
+		if outcome.Err == nil {
+			succeeded = append(succeeded, outcome)
+		}
+	}
+
+	if output == outputDiff {
+		for _, outcome := range succeeded {
+			if err := app.DiffRefactoringResult(ctx, outcome.Request, outcome.Result, c.out, c.isColorEnabled()); err != nil {
+				return 0, err
+			}
+		}
+		c.logger.Debug("DiffRefactoringResult succeeded")
+		return 0, nil
+	}
+
+	if !o.force {
+		// The results have full contents of the files, so they revert modifications made after the fetch step
+		var stale []string
+		for _, outcome := range succeeded {
+			files, err := app.StaleFiles(outcome.Request, outcome.Result)
+			if err != nil {
+				return 0, err
+			}
+			stale = append(stale, files...)
+		}
+		if len(stale) > 0 {
+			return 0, fmt.Errorf("refused to apply since files are modified after the fetch step: %s. Run fetch and generate again, or specify -force to overwrite them", strings.Join(stale, ", "))
+		}
+	}
+
+	failed := 0
+	appliedPerOutcome := make([][]*corefactorer.AppliedFile, len(succeeded))
+	for i, outcome := range succeeded {
+		applied, err := app.ApplyRefactoringResult(ctx, outcome.Request, outcome.Result)
+		if err != nil {
+			c.outputError(err)
+			failed++
+			continue
+		}
+		appliedPerOutcome[i] = applied
+	}
+	c.logger.Debug("ApplyRefactoringResult succeeded")
+
+	if o.verify || len(o.verifyCmds) > 0 {
+		// Verify after all the requests are applied since a refactoring may span the split target files.
+		// A request which fails the verification is restored, and the others are kept.
+		for i, outcome := range succeeded {
+			if appliedPerOutcome[i] == nil {
+				continue
+			}
+			applied, err := app.VerifyAndRepairAppliedFiles(ctx, outcome.Request, outcome.Result, appliedPerOutcome[i], o.verifyCmds, o.maxRepairAttempts)
+			if err != nil {
+				c.outputError(err)
+				if err := app.RestoreFiles(ctx, applied); err != nil {
+					c.outputError(err)
+				}
+				failed++
+			}
+		}
+		c.logger.Debug("VerifyAndRepairAppliedFiles succeeded")
+	}
+	return failed, nil
+}
+
+// runPipeline runs all the steps in a process. The state is saved after each step if -state is specified.
+func (c *cli) runPipeline(name string, args []string) int {
+	o := &options{}
+	flagSet := newFlagSet(c, name)
+	o.registerStateFlag(flagSet, "", "Specify a path of state file to save the output of each step. It's not saved if empty")
+	o.registerPlanFlags(flagSet)
+	o.registerModelFlags(flagSet)
+	o.registerFetchFlags(flagSet)
+	o.registerGenerateFlags(flagSet)
+	o.registerApplyFlags(flagSet, true)
+	if err := flagSet.Parse(args); err != nil {
+		flagSet.Usage()
+		return ExitError
+	}
+	if err := c.applyConfig(flagSet, o); err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+	if _, err := o.outputMode(); err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+	if _, err := o.diffFilter(); err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+
+	agent, err := c.newAgent(o)
+	if err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+	app, err := c.newApp(o, agent)
+	if err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+
+	ctx := context.Background()
+	state := &corefactorer.State{}
+	target, err := c.plan(ctx, o, app)
+	if err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+	state.Target = target
+	if explicit, _ := o.explicitTarget(); explicit {
+		app.SetModel(o.model, float32(o.temperature))
+	}
+	if err := c.saveState(o, state); err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+
+	request, err := c.fetch(ctx, o, app, target)
+	if err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+	state.Request = request
+	if err := c.saveState(o, state); err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+
+	outcomes, err := c.generate(ctx, o, app, request)
+	if err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+	state.Model = o.model
+	state.Results = corefactorer.NewStateResults(outcomes)
+	if err := c.saveState(o, state); err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+
+	failed := countFailedOutcomes(outcomes)
+	applyFailed, err := c.apply(ctx, o, app, outcomes)
+	if err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+	return c.exitCode(failed+applyFailed, len(outcomes))
+}
+
+// runPlan saves RefactoringTarget created from the prompt or the flags to the state file.
+func (c *cli) runPlan(args []string) int {
+	o := &options{}
+	flagSet := newFlagSet(c, "co-refactorer plan")
+	o.registerStateFlag(flagSet, corefactorer.DefaultStateFile, "Specify a path of state file to save the target")
+	o.registerPlanFlags(flagSet)
+	o.registerModelFlags(flagSet)
+	if err := flagSet.Parse(args); err != nil {
+		return ExitError
+	}
+	if err := c.applyConfig(flagSet, o); err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+
+	var app *corefactorer.App
+	if explicit, err := o.explicitTarget(); err != nil {
+		c.outputError(err)
+		return ExitError
+	} else if !explicit {
+		// LLM is used only to extract the target from the prompt
+		agent, err := c.newAgent(o)
+		if err != nil {
+			c.outputError(err)
+			return ExitError
+		}
+		app = corefactorer.New(c.logger, agent, nil, http.DefaultClient)
+	}
+	target, err := c.plan(context.Background(), o, app)
+	if err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+	if err := c.saveState(o, &corefactorer.State{Target: target}); err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+	return ExitOK
+}
+
+// runFetch saves RefactoringRequest created from the target in the state file.
+func (c *cli) runFetch(args []string) int {
+	o := &options{}
+	flagSet := newFlagSet(c, "co-refactorer fetch")
+	o.registerStateFlag(flagSet, corefactorer.DefaultStateFile, "Specify a path of state file which has the target and saves the request")
+	o.registerFetchFlags(flagSet)
+	if err := flagSet.Parse(args); err != nil {
+		return ExitError
+	}
+	if err := c.applyConfig(flagSet, o); err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+
+	state, err := c.loadState(o, "plan")
+	if err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+	app, err := c.newApp(o, nil)
+	if err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+	request, err := c.fetch(context.Background(), o, app, state.Target)
+	if err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+	state.Request = request
+	state.Model = ""
+	state.Results = nil
+	if err := c.saveState(o, state); err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+	return ExitOK
+}
+
+// runGenerate saves RefactoringResults generated from the request in the state file.
+func (c *cli) runGenerate(args []string) int {
+	o := &options{}
+	flagSet := newFlagSet(c, "co-refactorer generate")
+	o.registerStateFlag(flagSet, corefactorer.DefaultStateFile, "Specify a path of state file which has the request and saves the results")
+	o.registerModelFlags(flagSet)
+	o.registerGenerateFlags(flagSet)
+	if err := flagSet.Parse(args); err != nil {
+		return ExitError
+	}
+	if err := c.applyConfig(flagSet, o); err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+
+	state, err := c.loadState(o, "fetch")
+	if err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+	agent, err := c.newAgent(o)
+	if err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+	app := corefactorer.New(c.logger, agent, nil, http.DefaultClient)
+	app.SetModel(o.model, float32(o.temperature))
+	outcomes, err := c.generate(context.Background(), o, app, state.Request)
+	if err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+	state.Model = o.model
+	state.Results = corefactorer.NewStateResults(outcomes)
+	if err := c.saveState(o, state); err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+	return c.exitCode(countFailedOutcomes(outcomes), len(outcomes))
+}
+
+// runApply applies the results in the state file. The results are not repaired by LLM
+// since the conversations are not saved in the state file.
+func (c *cli) runApply(args []string) int {
+	o := &options{}
+	flagSet := newFlagSet(c, "co-refactorer apply")
+	o.registerStateFlag(flagSet, corefactorer.DefaultStateFile, "Specify a path of state file which has the results")
+	o.registerApplyFlags(flagSet, false)
+	if err := flagSet.Parse(args); err != nil {
+		return ExitError
+	}
+	if err := c.applyConfig(flagSet, o); err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+	// The results can't be repaired without the conversations with LLM
+	o.maxRepairAttempts = 0
+
+	state, err := c.loadState(o, "generate")
+	if err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+	outcomes := state.Outcomes()
+	skipped := countFailedOutcomes(outcomes)
+	if skipped > 0 {
+		c.logger.Info(fmt.Sprintf("%d of %d requests failed in generate step and are skipped", skipped, len(outcomes)))
+	}
+	app := corefactorer.New(c.logger, nil, nil, http.DefaultClient)
+	failed, err := c.apply(context.Background(), o, app, outcomes)
+	if err != nil {
+		c.outputError(err)
+		return ExitError
+	}
+	return c.exitCode(skipped+failed, len(outcomes))
+}
+
+// loadState loads the state file and checks that the output of `previousStep` exists.
+func (c *cli) loadState(o *options, previousStep string) (*corefactorer.State, error) {
+	state, err := corefactorer.LoadState(o.statePath)
+	if err != nil {
+		return nil, err
+	}
+	missing := false
+	switch previousStep {
+	case "plan":
+		missing = state.Target == nil
+	case "fetch":
+		missing = state.Request == nil
+	case "generate":
+		missing = len(state.Results) == 0
+	}
+	if missing {
+		return nil, fmt.Errorf("state file '%s' has no output of %s step: run `co-refactorer %s` first", o.statePath, previousStep, previousStep)
+	}
+	return state, nil
+}
+
+// saveState saves the state to the state file if it's specified.
+func (c *cli) saveState(o *options, state *corefactorer.State) error {
+	if o.statePath == "" {
+		return nil
+	}
+	if err := state.Save(o.statePath); err != nil {
+		return err
+	}
+	c.logger.Debug("State saved", slog.String("path", o.statePath))
+	return nil
+}
+
+func countFailedOutcomes(outcomes []*corefactorer.RefactoringOutcome) int {
+	failed := 0
+	for _, o := range outcomes {
+		if o.Err != nil {
+			failed++
+		}
+	}
+	return failed
+}
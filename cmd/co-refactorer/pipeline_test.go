@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oinume/corefactorer"
+)
+
+// chdir changes the current directory to `dir` during the test since the subcommands work in the current directory.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func saveTestState(t *testing.T, path string, original string, refactored string) {
+	t.Helper()
+	request := &corefactorer.RefactoringRequest{
+		UserPrompt:  "Add A",
+		TargetFiles: []*corefactorer.TargetFile{{Path: "a.go", Content: original}},
+	}
+	state := &corefactorer.State{
+		Target:  &corefactorer.RefactoringTarget{UserPrompt: "Add A", Files: []string{"a.go"}},
+		Request: request,
+		Model:   "gpt-4o",
+		Results: corefactorer.NewStateResults([]*corefactorer.RefactoringOutcome{
+			{
+				Request: request,
+				Result: &corefactorer.RefactoringResult{
+					Files: []*corefactorer.RefactoredFile{{Path: "a.go", Content: refactored}},
+				},
+			},
+		}),
+	}
+	if err := state.Save(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_cli_runApply_MaxRepairAttemptsInConfig(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	original := "package a\n"
+	writeFiles(t, dir, map[string]string{
+		"a.go":                      original,
+		corefactorer.ConfigFileName: "verify: false\nverify_commands: [\"false\"]\nmax_repair_attempts: 2\n",
+	})
+	saveTestState(t, corefactorer.DefaultStateFile, original, "package a\n\nfunc A() {}\n")
+
+	var stdout, stderr bytes.Buffer
+	c := newCLI(strings.NewReader(""), &stdout, &stderr)
+	if got := c.run([]string{"co-refactorer", "apply"}); got != ExitError {
+		t.Fatalf("run() = %d, want %d: %s", got, ExitError, stderr.String())
+	}
+	if strings.Contains(stderr.String(), "repair") {
+		t.Errorf("apply must not repair the results: %s", stderr.String())
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "a.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != original {
+		t.Errorf("a.go must be restored after the verification failed: %q", content)
+	}
+}
+
+func Test_cli_runApply_StaleFile(t *testing.T) {
+	const modified = "package a\n\n// Modified after fetch\n"
+	tests := []struct {
+		name        string
+		args        []string
+		wantCode    int
+		wantContent string
+	}{
+		{
+			name:        "refused",
+			args:        []string{"co-refactorer", "apply", "-verify=false"},
+			wantCode:    ExitError,
+			wantContent: modified,
+		},
+		{
+			name:        "force",
+			args:        []string{"co-refactorer", "apply", "-verify=false", "-force"},
+			wantCode:    ExitOK,
+			wantContent: "package a\n\nfunc A() {}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			chdir(t, dir)
+			t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+			writeFiles(t, dir, map[string]string{"a.go": modified})
+			saveTestState(t, corefactorer.DefaultStateFile, "package a\n", "package a\n\nfunc A() {}\n")
+
+			var stdout, stderr bytes.Buffer
+			c := newCLI(strings.NewReader(""), &stdout, &stderr)
+			if got := c.run(tt.args); got != tt.wantCode {
+				t.Fatalf("run() = %d, want %d: %s", got, tt.wantCode, stderr.String())
+			}
+			content, err := os.ReadFile(filepath.Join(dir, "a.go"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tt.wantContent {
+				t.Errorf("a.go = %q, want %q", content, tt.wantContent)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package corefactorer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ConfigFileName is a name of the project configuration file in the repository.
+	ConfigFileName = ".co-refactorer.yaml"
+
+	xdgConfigHomeEnv = "XDG_CONFIG_HOME"
+	userConfigDir    = "co-refactorer"
+	userConfigFile   = "config.yaml"
+)
+
+// Config is a configuration loaded from the user-level configuration file and the project configuration file.
+// Flags take precedence over it, and hosts in it are added to hosts in environment variables.
+type Config struct {
+	Model         string   `yaml:"model,omitempty"`
+	Temperature   *float64 `yaml:"temperature,omitempty"`
+	ContextWindow *int     `yaml:"context_window,omitempty"`
+	// PromptTemplate is a path of a template file of the assistance message. A relative path is resolved from
+	// the directory of the configuration file.
+	PromptTemplate string `yaml:"prompt_template,omitempty"`
+	// Lang is a language of the built-in prompt template like `en`.
+	Lang string `yaml:"lang,omitempty"`
+	// StyleGuide is a path of a style guide file of the project included in the prompt. A relative path is resolved
+	// in the same way as PromptTemplate.
+	StyleGuide string `yaml:"style_guide,omitempty"`
+
+	GitHubHosts    []string `yaml:"github_hosts,omitempty"`
+	GitLabHosts    []string `yaml:"gitlab_hosts,omitempty"`
+	GiteaHosts     []string `yaml:"gitea_hosts,omitempty"`
+	BitbucketHosts []string `yaml:"bitbucket_hosts,omitempty"`
+
+	// ExcludePaths are glob patterns of files excluded from the target files and the diffs of pull-requests.
+	ExcludePaths []string `yaml:"exclude_paths,omitempty"`
+
+	Verify            *bool    `yaml:"verify,omitempty"`
+	VerifyCommands    []string `yaml:"verify_commands,omitempty"`
+	MaxRepairAttempts *int     `yaml:"max_repair_attempts,omitempty"`
+
+	// APIKeyEnvs are environment variables of API keys keyed by provider name like `openai`.
+	APIKeyEnvs map[string]string `yaml:"api_key_envs,omitempty"`
+
+	// Files are the loaded configuration files in order of precedence from low to high.
+	Files []string `yaml:"-"`
+}
+
+// UserConfigPath returns the path of the user-level configuration file, which is
+// `$XDG_CONFIG_HOME/co-refactorer/config.yaml` or `~/.config/co-refactorer/config.yaml`.
+func UserConfigPath() (string, error) {
+	dir := os.Getenv(xdgConfigHomeEnv)
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, userConfigDir, userConfigFile), nil
+}
+
+// ProjectConfigPaths returns the paths of the project configuration files, which are ConfigFileName at the root of
+// the git repository containing the current directory and ConfigFileName in the current directory. The latter takes
+// precedence, so a subdirectory like a module in a monorepo can override the root. Only the current directory is used
+// outside of a git repository.
+func ProjectConfigPaths(ctx context.Context) ([]string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	output, err := exec.CommandContext(ctx, "git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		// Not in a git repository or git is not installed
+		return []string{ConfigFileName}, nil
+	}
+	root := strings.TrimSpace(string(output))
+	// git resolves symbolic links in the root
+	if resolved, err := filepath.EvalSymlinks(wd); err == nil {
+		wd = resolved
+	}
+	if root == "" || filepath.Clean(root) == wd {
+		return []string{ConfigFileName}, nil
+	}
+	return []string{filepath.Join(root, ConfigFileName), ConfigFileName}, nil
+}
+
+// LoadConfig loads the configuration files in order and merges them. A later file takes precedence.
+// Files which don't exist are skipped.
+func LoadConfig(paths ...string) (*Config, error) {
+	merged := &Config{}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file '%s': %w", path, err)
+		}
+		c, err := ParseConfig(content, path)
+		if err != nil {
+			return nil, err
+		}
+		merged.Merge(c)
+	}
+	return merged, nil
+}
+
+// ParseConfig parses and validates the content of the configuration file at `path`.
+func ParseConfig(content []byte, path string) (*Config, error) {
+	c := &Config{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid config file '%s': %w", path, err)
+	}
+	if c.PromptTemplate != "" && !filepath.IsAbs(c.PromptTemplate) {
+		c.PromptTemplate = filepath.Join(filepath.Dir(path), c.PromptTemplate)
+	}
+	if c.StyleGuide != "" && !filepath.IsAbs(c.StyleGuide) {
+		c.StyleGuide = filepath.Join(filepath.Dir(path), c.StyleGuide)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file '%s': %w", path, err)
+	}
+	c.Files = []string{path}
+	return c, nil
+}
+
+// Merge overrides the configuration with the specified values in `other`. Lists are replaced, not appended.
+func (c *Config) Merge(other *Config) {
+	if other.Model != "" {
+		c.Model = other.Model
+	}
+	if other.Temperature != nil {
+		c.Temperature = other.Temperature
+	}
+	if other.ContextWindow != nil {
+		c.ContextWindow = other.ContextWindow
+	}
+	if other.PromptTemplate != "" {
+		c.PromptTemplate = other.PromptTemplate
+	}
+	if other.Lang != "" {
+		c.Lang = other.Lang
+	}
+	if other.StyleGuide != "" {
+		c.StyleGuide = other.StyleGuide
+	}
+	if other.GitHubHosts != nil {
+		c.GitHubHosts = other.GitHubHosts
+	}
+	if other.GitLabHosts != nil {
+		c.GitLabHosts = other.GitLabHosts
+	}
+	if other.GiteaHosts != nil {
+		c.GiteaHosts = other.GiteaHosts
+	}
+	if other.BitbucketHosts != nil {
+		c.BitbucketHosts = other.BitbucketHosts
+	}
+	if other.ExcludePaths != nil {
+		c.ExcludePaths = other.ExcludePaths
+	}
+	if other.Verify != nil {
+		c.Verify = other.Verify
+	}
+	if other.VerifyCommands != nil {
+		c.VerifyCommands = other.VerifyCommands
+	}
+	if other.MaxRepairAttempts != nil {
+		c.MaxRepairAttempts = other.MaxRepairAttempts
+	}
+	for provider, env := range other.APIKeyEnvs {
+		if c.APIKeyEnvs == nil {
+			c.APIKeyEnvs = make(map[string]string)
+		}
+		c.APIKeyEnvs[provider] = env
+	}
+	c.Files = append(c.Files, other.Files...)
+}
+
+// Validate checks the values and returns an error which tells the invalid key.
+func (c *Config) Validate() error {
+	if c.Model != "" {
+		if _, err := FindAgentProvider(c.Model); err != nil {
+			return fmt.Errorf("model: %w", err)
+		}
+	}
+	if c.Temperature != nil && (*c.Temperature < 0 || *c.Temperature > 2) {
+		return fmt.Errorf("temperature: must be between 0 and 2: %v", *c.Temperature)
+	}
+	if c.ContextWindow != nil && *c.ContextWindow < 0 {
+		return fmt.Errorf("context_window: must not be negative: %d", *c.ContextWindow)
+	}
+	if c.PromptTemplate != "" {
+		if _, err := LoadPromptTemplate(c.PromptTemplate); err != nil {
+			return fmt.Errorf("prompt_template: %w", err)
+		}
+	}
+	if c.Lang != "" {
+		if _, err := BuiltinPromptTemplate(c.Lang); err != nil {
+			return fmt.Errorf("lang: %w", err)
+		}
+	}
+	if c.StyleGuide != "" {
+		if _, err := os.Stat(c.StyleGuide); err != nil {
+			return fmt.Errorf("style_guide: %w", err)
+		}
+	}
+	hosts := []struct {
+		key   string
+		hosts []string
+		parse func(string) error
+	}{
+		{key: "github_hosts", hosts: c.GitHubHosts, parse: func(s string) error { _, err := ParseGitHubHost(s); return err }},
+		{key: "gitlab_hosts", hosts: c.GitLabHosts, parse: func(s string) error { _, err := ParseGitLabHost(s); return err }},
+		{key: "gitea_hosts", hosts: c.GiteaHosts, parse: func(s string) error { _, err := ParseGiteaHost(s); return err }},
+		{key: "bitbucket_hosts", hosts: c.BitbucketHosts, parse: func(s string) error { _, err := ParseBitbucketHost(s); return err }},
+	}
+	for _, h := range hosts {
+		for _, s := range h.hosts {
+			if err := h.parse(s); err != nil {
+				return fmt.Errorf("%s: %w", h.key, err)
+			}
+		}
+	}
+	for _, p := range c.ExcludePaths {
+		if !doublestar.ValidatePattern(p) {
+			return fmt.Errorf("exclude_paths: invalid glob pattern '%s'", p)
+		}
+	}
+	for _, cmd := range c.VerifyCommands {
+		if cmd == "" {
+			return fmt.Errorf("verify_commands: empty command is not allowed")
+		}
+	}
+	if c.MaxRepairAttempts != nil && *c.MaxRepairAttempts < 0 {
+		return fmt.Errorf("max_repair_attempts: must not be negative: %d", *c.MaxRepairAttempts)
+	}
+	var providers []string
+	for _, p := range AgentProviders() {
+		providers = append(providers, p.Name)
+	}
+	for provider, env := range c.APIKeyEnvs {
+		if !slices.Contains(providers, provider) {
+			return fmt.Errorf("api_key_envs: unknown provider '%s': must be one of %v", provider, providers)
+		}
+		if env == "" {
+			return fmt.Errorf("api_key_envs: empty environment variable for provider '%s'", provider)
+		}
+	}
+	return nil
+}
+
+// YAML returns the configuration in YAML format.
+func (c *Config) YAML() (string, error) {
+	var b bytes.Buffer
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return "", fmt.Errorf("failed to encode config: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return "", fmt.Errorf("failed to encode config: %w", err)
+	}
+	return b.String(), nil
+}
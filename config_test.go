@@ -0,0 +1,167 @@
+package corefactorer
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_ParseConfig(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "prompt.tmpl"), []byte("Refactor {{ join .TargetPaths \", \" }}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, ConfigFileName)
+	temperature := 0.2
+	maxRepairAttempts := 0
+
+	tests := map[string]struct {
+		content string
+		want    *Config
+		wantErr string
+	}{
+		"normal": {
+			content: `
+model: gpt-4o
+temperature: 0.2
+prompt_template: prompt.tmpl
+github_hosts: [github.example.com]
+exclude_paths: ["docs/**"]
+verify_commands: ["go build ./..."]
+max_repair_attempts: 0
+api_key_envs:
+  openai: MY_OPENAI_API_KEY
+`,
+			want: &Config{
+				Model:             "gpt-4o",
+				Temperature:       &temperature,
+				PromptTemplate:    filepath.Join(dir, "prompt.tmpl"),
+				GitHubHosts:       []string{"github.example.com"},
+				ExcludePaths:      []string{"docs/**"},
+				VerifyCommands:    []string{"go build ./..."},
+				MaxRepairAttempts: &maxRepairAttempts,
+				APIKeyEnvs:        map[string]string{"openai": "MY_OPENAI_API_KEY"},
+				Files:             []string{path},
+			},
+		},
+		"empty": {
+			content: "",
+			want:    &Config{Files: []string{path}},
+		},
+		"unknown key": {
+			content: "modle: gpt-4o\n",
+			wantErr: "field modle not found",
+		},
+		"invalid temperature": {
+			content: "temperature: 3\n",
+			wantErr: "temperature: must be between 0 and 2",
+		},
+		"unknown lang": {
+			content: "lang: fr\n",
+			wantErr: "lang: unknown prompt language 'fr'",
+		},
+		"invalid exclude path": {
+			content: "exclude_paths: ['docs/[']\n",
+			wantErr: "exclude_paths: invalid glob pattern",
+		},
+		"missing prompt template": {
+			content: "prompt_template: missing.tmpl\n",
+			wantErr: "prompt_template: failed to read prompt template",
+		},
+		"unknown provider": {
+			content: "api_key_envs:\n  unknown: API_KEY\n",
+			wantErr: "api_key_envs: unknown provider 'unknown'",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseConfig([]byte(tt.content), path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), path) {
+					t.Fatalf("ParseConfig() error = %v, want error containing %q and the path", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_LoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	userPath := filepath.Join(dir, "user.yaml")
+	projectPath := filepath.Join(dir, ConfigFileName)
+	userContent := "model: gpt-4o\ntemperature: 0.5\nexclude_paths: ['vendor/**']\napi_key_envs:\n  openai: USER_OPENAI_API_KEY\n  claude: USER_CLAUDE_API_KEY\n"
+	projectContent := "model: claude-3-5-sonnet-20240620\nexclude_paths: ['docs/**']\napi_key_envs:\n  openai: PROJECT_OPENAI_API_KEY\n"
+	if err := os.WriteFile(userPath, []byte(userContent), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(projectPath, []byte(projectContent), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := LoadConfig(userPath, filepath.Join(dir, "missing.yaml"), projectPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	temperature := 0.5
+	want := &Config{
+		Model:        "claude-3-5-sonnet-20240620",
+		Temperature:  &temperature,
+		ExcludePaths: []string{"docs/**"},
+		APIKeyEnvs:   map[string]string{"openai": "PROJECT_OPENAI_API_KEY", "claude": "USER_CLAUDE_API_KEY"},
+		Files:        []string{userPath, projectPath},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadConfig() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_ProjectConfigPaths(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := filepath.Join(root, "repo")
+	sub := filepath.Join(repo, "sub")
+	notRepo := filepath.Join(root, "not-repo")
+	for _, dir := range []string{sub, notRepo} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if output, err := exec.Command("git", "-C", repo, "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v: %s", err, output)
+	}
+
+	tests := []struct {
+		name string
+		dir  string
+		want []string
+	}{
+		{name: "root of repository", dir: repo, want: []string{ConfigFileName}},
+		{name: "subdirectory of repository", dir: sub, want: []string{filepath.Join(repo, ConfigFileName), ConfigFileName}},
+		{name: "not in repository", dir: notRepo, want: []string{ConfigFileName}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chdir(t, tt.dir)
+			got, err := ProjectConfigPaths(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ProjectConfigPaths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package corefactorer
+
+import (
+	"strings"
+
+	"github.com/aymanbagabas/go-udiff"
+)
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiCyan  = "\x1b[36m"
+)
+
+// unifiedDiff returns a unified diff of the file in the format which `git apply` accepts.
+// `before` is nil if the file doesn't exist. It returns an empty string if there are no changes.
+func unifiedDiff(path string, before *string, after string) string {
+	fromFile, from := "/dev/null", ""
+	if before != nil {
+		fromFile, from = "a/"+path, *before
+	}
+	if before != nil && from == after {
+		return ""
+	}
+	return udiff.Unified(fromFile, "b/"+path, from, after)
+}
+
+// colorizeDiff colorizes the unified diff with ANSI escape sequences.
+func colorizeDiff(diff string) string {
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		if line == "" {
+			continue
+		}
+		body := strings.TrimSuffix(line, "\n")
+		newline := line[len(body):]
+		switch {
+		case strings.HasPrefix(body, "--- "), strings.HasPrefix(body, "+++ "):
+			b.WriteString(ansiBold + body + ansiReset + newline)
+		case strings.HasPrefix(body, "@@"):
+			b.WriteString(ansiCyan + body + ansiReset + newline)
+		case strings.HasPrefix(body, "-"):
+			b.WriteString(ansiRed + body + ansiReset + newline)
+		case strings.HasPrefix(body, "+"):
+			b.WriteString(ansiGreen + body + ansiReset + newline)
+		default:
+			b.WriteString(line)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,197 @@
+package corefactorer
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+const (
+	diffDropReasonNotIncluded = "not included"
+	diffDropReasonExcluded    = "excluded"
+	diffDropReasonGenerated   = "generated file"
+	diffDropReasonLockFile    = "lock file"
+	diffDropReasonVendored    = "vendored file"
+)
+
+var (
+	// generatedCodeRegexp matches the comment of generated Go files. See https://go.dev/s/generatedcode
+	generatedCodeRegexp = regexp.MustCompile(`(?m)^[+ -]// Code generated .* DO NOT EDIT\.$`)
+
+	lockFileNames = []string{
+		"go.sum",
+		"go.work.sum",
+		"package-lock.json",
+		"npm-shrinkwrap.json",
+		"yarn.lock",
+		"pnpm-lock.yaml",
+		"bun.lockb",
+		"Cargo.lock",
+		"Gemfile.lock",
+		"poetry.lock",
+		"Pipfile.lock",
+		"composer.lock",
+	}
+
+	vendoredDirPatterns = []string{
+		"vendor/**",
+		"**/vendor/**",
+		"node_modules/**",
+		"**/node_modules/**",
+	}
+)
+
+// DiffFilter filters files in diffs of pull-requests to keep the prompt small.
+type DiffFilter struct {
+	// Include is a list of glob patterns like `**/*.go`. Only matched files are kept if it's not empty.
+	Include []string
+	// Exclude is a list of glob patterns. Matched files are dropped.
+	Exclude []string
+	// KeepGenerated keeps generated files, lock files and vendored files which are dropped by default.
+	KeepGenerated bool
+}
+
+// Validate checks the glob patterns.
+func (f *DiffFilter) Validate() error {
+	for _, p := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if !doublestar.ValidatePattern(p) {
+			return fmt.Errorf("invalid glob pattern '%s'", p)
+		}
+	}
+	return nil
+}
+
+// DroppedDiff is a file dropped from a diff of a pull-request by DiffFilter.
+type DroppedDiff struct {
+	URL    string
+	Path   string
+	Reason string
+	// Size is bytes of the dropped diff.
+	Size int
+}
+
+func (d *DroppedDiff) String() string {
+	return fmt.Sprintf("%s in %s (%s, %d bytes)", d.Path, d.URL, d.Reason, d.Size)
+}
+
+// FilterDiffs drops files in diffs of the pull-requests with the filter, and returns the dropped files.
+func (r *RefactoringRequest) FilterDiffs(filter *DiffFilter) []*DroppedDiff {
+	var dropped []*DroppedDiff
+	for _, pr := range r.PullRequests {
+		var b strings.Builder
+		for _, fd := range splitDiff(pr.Diff) {
+			if reason := filter.dropReason(fd); reason != "" {
+				dropped = append(dropped, &DroppedDiff{
+					URL:    pr.URL,
+					Path:   fd.Path,
+					Reason: reason,
+					Size:   len(fd.Content),
+				})
+				continue
+			}
+			b.WriteString(fd.Content)
+		}
+		pr.Diff = b.String()
+	}
+	return dropped
+}
+
+// dropReason returns the reason why the file is dropped. It returns an empty string if the file is kept.
+func (f *DiffFilter) dropReason(fd *fileDiff) string {
+	if fd.Path == "" {
+		// Keep a preamble like headers of `git format-patch`
+		return ""
+	}
+	if len(f.Include) > 0 && !matchAnyPattern(f.Include, fd.Path) {
+		return diffDropReasonNotIncluded
+	}
+	if matchAnyPattern(f.Exclude, fd.Path) {
+		return diffDropReasonExcluded
+	}
+	if f.KeepGenerated {
+		return ""
+	}
+	if matchAnyPattern(vendoredDirPatterns, fd.Path) {
+		return diffDropReasonVendored
+	}
+	for _, name := range lockFileNames {
+		if path.Base(fd.Path) == name {
+			return diffDropReasonLockFile
+		}
+	}
+	if generatedCodeRegexp.MatchString(fd.Content) {
+		return diffDropReasonGenerated
+	}
+	return ""
+}
+
+func matchAnyPattern(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := doublestar.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fileDiff is a diff of a file in a unified diff of `git diff`.
+type fileDiff struct {
+	// Path is a path of the file after the change, or before the change if the file is deleted.
+	// It's empty for a preamble before the first file.
+	Path string
+	// Content is the diff including the `diff --git` header.
+	Content string
+}
+
+// splitDiff splits the output of `git diff` into per-file diffs. Concatenating the contents gives the original diff.
+func splitDiff(diff string) []*fileDiff {
+	var (
+		files    []*fileDiff
+		current  *fileDiff
+		b        strings.Builder
+		inHeader bool
+	)
+	flush := func() {
+		if current != nil {
+			current.Content = b.String()
+			b.Reset()
+		}
+	}
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		if line == "" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			current = &fileDiff{Path: diffHeaderPath(line)}
+			files = append(files, current)
+			inHeader = true
+		case current == nil:
+			current = &fileDiff{}
+			files = append(files, current)
+		case inHeader && strings.HasPrefix(line, "@@"):
+			inHeader = false
+		case inHeader:
+			// `+++ b/<path>` is more reliable than the `diff --git` line when the path contains " b/"
+			if p, ok := strings.CutPrefix(line, "+++ b/"); ok {
+				current.Path = strings.TrimRight(p, "\r\n")
+			}
+		}
+		b.WriteString(line)
+	}
+	flush()
+	return files
+}
+
+// diffHeaderPath returns the path after the change in `diff --git a/<old> b/<new>` line.
+func diffHeaderPath(line string) string {
+	header := strings.TrimRight(strings.TrimPrefix(line, "diff --git "), "\r\n")
+	if i := strings.LastIndex(header, " b/"); i >= 0 {
+		return header[i+len(" b/"):]
+	}
+	return header
+}
@@ -0,0 +1,81 @@
+package corefactorer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_splitDiff(t *testing.T) {
+	diff := "From 1234 Mon Sep 17 00:00:00 2001\n\n" +
+		"diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n-a\n+b\n" +
+		"diff --git a/old.go b/new.go\nrename from old.go\nrename to new.go\n" +
+		"diff --git a/c.go b/c.go\ndeleted file mode 100644\n--- a/c.go\n+++ /dev/null\n@@ -1 +0,0 @@\n-c\n"
+	got := splitDiff(diff)
+	var paths []string
+	var joined strings.Builder
+	for _, fd := range got {
+		paths = append(paths, fd.Path)
+		joined.WriteString(fd.Content)
+	}
+	if want := []string{"", "a.go", "new.go", "c.go"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("splitDiff() paths = %v, want %v", paths, want)
+	}
+	if joined.String() != diff {
+		t.Errorf("splitDiff() joined contents = %q, want %q", joined.String(), diff)
+	}
+}
+
+func Test_RefactoringRequest_FilterDiffs(t *testing.T) {
+	const (
+		goDiff        = "diff --git a/server/handler.go b/server/handler.go\n--- a/server/handler.go\n+++ b/server/handler.go\n@@ -1 +1 @@\n-a\n+b\n"
+		docDiff       = "diff --git a/docs/README.md b/docs/README.md\n--- a/docs/README.md\n+++ b/docs/README.md\n@@ -1 +1 @@\n-a\n+b\n"
+		goSumDiff     = "diff --git a/go.sum b/go.sum\n--- a/go.sum\n+++ b/go.sum\n@@ -1 +1 @@\n-a\n+b\n"
+		generatedDiff = "diff --git a/api/api.pb.go b/api/api.pb.go\n--- a/api/api.pb.go\n+++ b/api/api.pb.go\n@@ -1,3 +1,3 @@\n // Code generated by protoc-gen-go. DO NOT EDIT.\n-a\n+b\n"
+		vendorDiff    = "diff --git a/vendor/x/x.go b/vendor/x/x.go\n--- a/vendor/x/x.go\n+++ b/vendor/x/x.go\n@@ -1 +1 @@\n-a\n+b\n"
+	)
+	const url = "https://github.com/oinume/co-refactorer/pull/1"
+	diff := goDiff + docDiff + goSumDiff + generatedDiff + vendorDiff
+
+	tests := []struct {
+		name        string
+		filter      *DiffFilter
+		wantDiff    string
+		wantDropped []*DroppedDiff
+	}{
+		{
+			name:     "default",
+			filter:   &DiffFilter{},
+			wantDiff: goDiff + docDiff,
+			wantDropped: []*DroppedDiff{
+				{URL: url, Path: "go.sum", Reason: diffDropReasonLockFile, Size: len(goSumDiff)},
+				{URL: url, Path: "api/api.pb.go", Reason: diffDropReasonGenerated, Size: len(generatedDiff)},
+				{URL: url, Path: "vendor/x/x.go", Reason: diffDropReasonVendored, Size: len(vendorDiff)},
+			},
+		},
+		{
+			name:     "include and exclude",
+			filter:   &DiffFilter{Include: []string{"**/*.go"}, Exclude: []string{"api/**"}, KeepGenerated: true},
+			wantDiff: goDiff + vendorDiff,
+			wantDropped: []*DroppedDiff{
+				{URL: url, Path: "docs/README.md", Reason: diffDropReasonNotIncluded, Size: len(docDiff)},
+				{URL: url, Path: "go.sum", Reason: diffDropReasonNotIncluded, Size: len(goSumDiff)},
+				{URL: url, Path: "api/api.pb.go", Reason: diffDropReasonExcluded, Size: len(generatedDiff)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &RefactoringRequest{
+				PullRequests: []*PullRequest{{URL: url, Diff: diff}},
+			}
+			gotDropped := r.FilterDiffs(tt.filter)
+			if got := r.PullRequests[0].Diff; got != tt.wantDiff {
+				t.Errorf("FilterDiffs() diff = %q, want %q", got, tt.wantDiff)
+			}
+			if !reflect.DeepEqual(gotDropped, tt.wantDropped) {
+				t.Errorf("FilterDiffs() dropped = %v, want %v", gotDropped, tt.wantDropped)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package corefactorer
+
+import (
+	"testing"
+)
+
+func Test_unifiedDiff(t *testing.T) {
+	before := "package main\n\nimport \"io/ioutil\"\n"
+	type args struct {
+		path   string
+		before *string
+		after  string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "modified",
+			args: args{
+				path:   "a.go",
+				before: &before,
+				after:  "package main\n\nimport \"io\"\n",
+			},
+			want: `--- a/a.go
++++ b/a.go
+@@ -1,3 +1,3 @@
+ package main
+ 
+-import "io/ioutil"
++import "io"
+`,
+		},
+		{
+			name: "new file",
+			args: args{
+				path:   "b.go",
+				before: nil,
+				after:  "package main\n",
+			},
+			want: `--- /dev/null
++++ b/b.go
+@@ -0,0 +1 @@
++package main
+`,
+		},
+		{
+			name: "no changes",
+			args: args{
+				path:   "a.go",
+				before: &before,
+				after:  before,
+			},
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff(tt.args.path, tt.args.before, tt.args.after); got != tt.want {
+				t.Errorf("unifiedDiff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package corefactorer
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const (
+	// DefaultDiscoverMinScore is a default minimum score of files proposed by DiscoverTargetFiles.
+	DefaultDiscoverMinScore = 0.3
+
+	// minSignatureLineLength is a minimum length of a normalized line used as a signature of the "before" pattern.
+	// Shorter lines like `}` or `return nil` are too common to tell anything.
+	minSignatureLineLength = 12
+)
+
+var (
+	stringLiteralRegexp = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|` + "`[^`]*`" + `|'(?:[^'\\]|\\.)*'`)
+	numberLiteralRegexp = regexp.MustCompile(`\b[0-9][0-9a-fA-FxX_.]*\b`)
+	whitespaceRegexp    = regexp.MustCompile(`\s+`)
+)
+
+// DiscoveredFile is a file which contains code similar to the removed side of the diffs.
+type DiscoveredFile struct {
+	Path string
+	// Score is a ratio of the signature lines of the "before" pattern found in the file.
+	Score float64
+	// MatchedLines are the normalized signature lines found in the file.
+	MatchedLines []string
+}
+
+// DiscoverTargetFiles fetches the references and proposes files which contain code similar to the "before" pattern,
+// which is the removed side of the diffs. The files are searched with the patterns like RefactoringTarget.Files,
+// and files matching `excludes` glob patterns are skipped. See discoverFiles for the details of the similarity.
+func (a *App) DiscoverTargetFiles(ctx context.Context, refs []string, patterns []string, excludes []string, minScore float64) ([]*DiscoveredFile, error) {
+	var pullRequests []*PullRequest
+	for _, ref := range refs {
+		source, err := findReferenceSource(a.referenceSources, ref)
+		if err != nil {
+			return nil, err
+		}
+		pr, err := source.Fetch(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		pullRequests = append(pullRequests, pr)
+	}
+	return discoverFiles(ctx, "", pullRequests, patterns, excludes, minScore)
+}
+
+// discoverFiles searches files in `dir` which contain the signature lines of the "before" pattern of the pull-requests.
+// The signature lines are lines which are removed and not added back in the diffs, normalized by replacing literals
+// and whitespaces so that the same code shape with different values is matched. A file is compared with the signature
+// lines of the changed files with the same extension. The files are sorted by score in descending order.
+func discoverFiles(ctx context.Context, dir string, pullRequests []*PullRequest, patterns []string, excludes []string, minScore float64) ([]*DiscoveredFile, error) {
+	signatures := beforePatternSignatures(pullRequests)
+	if len(signatures) == 0 {
+		return nil, fmt.Errorf("no removed code to discover similar files in the diffs")
+	}
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	paths, _, err := expandFilePatterns(ctx, dir, patterns, excludes)
+	if err != nil {
+		return nil, err
+	}
+
+	var discovered []*DiscoveredFile
+	for _, p := range paths {
+		extSignatures, ok := signatures[filepath.Ext(p)]
+		if !ok {
+			continue
+		}
+		lines, err := normalizedFileLines(joinDir(dir, p))
+		if err != nil {
+			return nil, err
+		}
+		var matched []string
+		for _, s := range extSignatures {
+			if _, ok := lines[s]; ok {
+				matched = append(matched, s)
+			}
+		}
+		score := float64(len(matched)) / float64(len(extSignatures))
+		if len(matched) == 0 || score < minScore {
+			continue
+		}
+		discovered = append(discovered, &DiscoveredFile{
+			Path:         p,
+			Score:        score,
+			MatchedLines: matched,
+		})
+	}
+	slices.SortStableFunc(discovered, func(a, b *DiscoveredFile) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	return discovered, nil
+}
+
+// beforePatternSignatures returns the sorted signature lines of the "before" pattern keyed by extension of the changed files.
+func beforePatternSignatures(pullRequests []*PullRequest) map[string][]string {
+	removed := make(map[string]map[string]struct{})
+	added := make(map[string]struct{})
+	for _, pr := range pullRequests {
+		for _, fd := range splitDiff(pr.Diff) {
+			if fd.Path == "" {
+				continue
+			}
+			ext := filepath.Ext(fd.Path)
+			if removed[ext] == nil {
+				removed[ext] = make(map[string]struct{})
+			}
+			inHeader := true
+			for _, line := range strings.Split(fd.Content, "\n") {
+				if inHeader {
+					inHeader = !strings.HasPrefix(line, "@@")
+					continue
+				}
+				switch {
+				case strings.HasPrefix(line, "-"):
+					removed[ext][normalizeCodeLine(line[1:])] = struct{}{}
+				case strings.HasPrefix(line, "+"):
+					added[normalizeCodeLine(line[1:])] = struct{}{}
+				}
+			}
+		}
+	}
+
+	signatures := make(map[string][]string)
+	for ext, lines := range removed {
+		for line := range lines {
+			if _, ok := added[line]; ok {
+				continue
+			}
+			if len(line) < minSignatureLineLength || !strings.ContainsFunc(line, unicode.IsLetter) {
+				continue
+			}
+			signatures[ext] = append(signatures[ext], line)
+		}
+		slices.Sort(signatures[ext])
+	}
+	return signatures
+}
+
+// normalizedFileLines returns the set of normalized lines of the file.
+func normalizedFileLines(name string) (map[string]struct{}, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file '%s': %w", name, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	lines := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines[normalizeCodeLine(scanner.Text())] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file '%s': %w", name, err)
+	}
+	return lines, nil
+}
+
+// normalizeCodeLine replaces string and number literals with placeholders and collapses whitespaces,
+// so that `{name: "ok", want: 1},` and `{name:  "ng", want: 2},` are the same.
+func normalizeCodeLine(line string) string {
+	line = stringLiteralRegexp.ReplaceAllString(line, `""`)
+	line = numberLiteralRegexp.ReplaceAllString(line, "0")
+	line = whitespaceRegexp.ReplaceAllString(line, " ")
+	return strings.TrimSpace(line)
+}
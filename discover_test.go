@@ -0,0 +1,131 @@
+package corefactorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_normalizeCodeLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{line: "\t\t{name:  \"ok\", want: 1},", want: `{name: "", want: 0},`},
+		{line: "\tx := `raw` + 'c' + \"a\\\"b\"", want: `x := "" + "" + ""`},
+		{line: "  t.Run(tt.name, func(t *testing.T) {  ", want: "t.Run(tt.name, func(t *testing.T) {"},
+	}
+	for _, tt := range tests {
+		if got := normalizeCodeLine(tt.line); got != tt.want {
+			t.Errorf("normalizeCodeLine(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func Test_discoverFiles(t *testing.T) {
+	const diff = `diff --git a/a_test.go b/a_test.go
+--- a/a_test.go
++++ b/a_test.go
+@@ -1,12 +1,12 @@
+ func TestA(t *testing.T) {
+-	tests := []struct {
+-		name string
++	tests := map[string]struct {
+ 		want int
+ 	}{
+-		{name: "ok", want: 1},
++		"ok": {want: 1},
+ 	}
+-	for _, tt := range tests {
+-		t.Run(tt.name, func(t *testing.T) {
++	for name, tt := range tests {
++		t.Run(name, func(t *testing.T) {
+ 			if got := A(); got != tt.want {
+ 				t.Errorf("A() = %v, want %v", got, tt.want)
+ 			}
+diff --git a/README.md b/README.md
+--- a/README.md
++++ b/README.md
+@@ -1 +1 @@
+-Table driven tests use a slice.
++Table driven tests use a map.
+`
+	dir := t.TempDir()
+	files := map[string]string{
+		"b_test.go": `func TestB(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "empty", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+		})
+	}
+}
+`,
+		"c_test.go": `func TestC(t *testing.T) {
+	for _, tt := range tests {
+	}
+}
+`,
+		"d_test.go": `func TestD(t *testing.T) {
+	tests := map[string]struct {
+		want int
+	}{}
+}
+`,
+		"e.txt": "tests := []struct {\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pullRequests := []*PullRequest{{URL: "git:HEAD", Diff: diff}}
+
+	tests := []struct {
+		name     string
+		excludes []string
+		minScore float64
+		want     map[string]float64
+	}{
+		{
+			name:     "default min score",
+			minScore: DefaultDiscoverMinScore,
+			want:     map[string]float64{"b_test.go": 0.75},
+		},
+		{
+			name:     "low min score",
+			minScore: 0,
+			want:     map[string]float64{"b_test.go": 0.75, "c_test.go": 0.25},
+		},
+		{
+			name:     "excludes",
+			excludes: []string{"c_*.go"},
+			minScore: 0,
+			want:     map[string]float64{"b_test.go": 0.75},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := discoverFiles(context.Background(), dir, pullRequests, nil, tt.excludes, tt.minScore)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotScores := make(map[string]float64, len(got))
+			for _, f := range got {
+				gotScores[f.Path] = f.Score
+			}
+			if !reflect.DeepEqual(gotScores, tt.want) {
+				t.Errorf("discoverFiles() = %v, want %v", gotScores, tt.want)
+			}
+			if got[0].Path != "b_test.go" {
+				t.Errorf("discoverFiles()[0] = %v, want b_test.go", got[0].Path)
+			}
+		})
+	}
+}
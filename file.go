@@ -0,0 +1,96 @@
+package corefactorer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultFilePerm = 0o644
+	defaultDirPerm  = 0o755
+)
+
+// writeFileAtomic writes the content to a temporary file in the same directory and renames it to `path` atomically,
+// so the file never contains partially written or stale content. The mode of the existing file is preserved.
+func writeFileAtomic(path string, content []byte) (err error) {
+	perm := fs.FileMode(defaultFilePerm)
+	fi, err := os.Stat(path)
+	if err == nil {
+		perm = fi.Mode().Perm()
+	} else if errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(path), defaultDirPerm); err != nil {
+			return fmt.Errorf("failed to create directory of '%s': %w", path, err)
+		}
+	} else {
+		return fmt.Errorf("failed to stat '%s': %w", path, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for '%s': %w", path, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	if _, err := tmp.Write(content); err != nil {
+		return fmt.Errorf("failed to write temporary file '%s': %w", tmp.Name(), err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync temporary file '%s': %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file '%s': %w", tmp.Name(), err)
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return fmt.Errorf("failed to chmod temporary file '%s': %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to rename '%s' to '%s': %w", tmp.Name(), path, err)
+	}
+	return nil
+}
+
+// relativePathInDir resolves `path` following symbolic links and returns the path relative to `dir`.
+// It returns an error if the resolved path is not inside `dir`.
+func relativePathInDir(dir string, path string) (string, error) {
+	resolvedDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve directory '%s': %w", dir, err)
+	}
+	absPath := path
+	if !filepath.IsAbs(absPath) {
+		absPath = filepath.Join(dir, path)
+	}
+
+	// Resolve the nearest existing ancestor since the file (and its parent directories) may not exist yet
+	existing, rest := absPath, ""
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			absPath = filepath.Join(resolved, rest)
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("failed to resolve '%s': %w", path, err)
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+
+	rel, err := filepath.Rel(resolvedDir, absPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("'%s' is outside of the working tree '%s'", path, dir)
+	}
+	return rel, nil
+}
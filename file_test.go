@@ -0,0 +1,98 @@
+package corefactorer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_writeFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\necho 'long long content'\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "#!/bin/sh\necho 1\n"
+	if err := writeFileAtomic(path, []byte(want)); err != nil {
+		t.Fatalf("writeFileAtomic() error = %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("writeFileAtomic() content = %q, want %q", string(got), want)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o755 {
+		t.Errorf("writeFileAtomic() mode = %v, want %v", fi.Mode().Perm(), os.FileMode(0o755))
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("temporary file must be removed: %v", entries)
+	}
+}
+
+func Test_relativePathInDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte("package a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(os.TempDir(), filepath.Join(dir, "outside")); err != nil {
+		t.Fatal(err)
+	}
+
+	type args struct {
+		path string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "existing file",
+			args: args{path: "a.go"},
+			want: "a.go",
+		},
+		{
+			name: "new file in new directory",
+			args: args{path: "./x/../y/b.go"},
+			want: filepath.Join("y", "b.go"),
+		},
+		{
+			name:    "parent directory",
+			args:    args{path: "../../etc/passwd"},
+			wantErr: true,
+		},
+		{
+			name:    "absolute path",
+			args:    args{path: "/etc/passwd"},
+			wantErr: true,
+		},
+		{
+			name:    "symbolic link to outside",
+			args:    args{path: "outside/a.go"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := relativePathInDir(dir, tt.args.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("relativePathInDir() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("relativePathInDir() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,67 +2,71 @@ package corefactorer
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"os"
+	"slices"
 
 	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/option"
 )
 
+const geminiProviderName = "gemini"
+
+func init() {
+	RegisterAgentProvider(&AgentProvider{
+		Name:          geminiProviderName,
+		Description:   "Google Gemini API",
+		ModelPrefixes: []string{"gemini-"},
+		Models: []string{
+			"gemini-1.5-pro",
+			"gemini-1.5-flash",
+			"gemini-1.0-pro",
+		},
+		RequiredEnvs: []string{geminiAPIKeyEnv},
+		ContextWindows: map[string]int{
+			"gemini-1.5-pro":   2097152,
+			"gemini-1.5-flash": 1048576,
+			"gemini-1.0-pro":   32760,
+		},
+		DefaultContextWindow: 32760,
+		MaxOutputTokens: map[string]int{
+			"gemini-1.0-pro": 2048,
+		},
+		DefaultMaxOutputTokens: 8192,
+		CharsPerToken:          4,
+		New: func(model string, config *AgentConfig, logger *slog.Logger) (Agent, error) {
+			client, err := genai.NewClient(context.Background(), option.WithAPIKey(os.Getenv(config.apiKeyEnv(geminiAPIKeyEnv))))
+			if err != nil {
+				return nil, fmt.Errorf("genai.NewClient failed: %w", err)
+			}
+			return NewGeminiAgent(client, config.SystemPrompt, logger), nil
+		},
+	})
+}
+
 type GeminiAgent struct {
 	client      *genai.Client
 	chatSession *genai.ChatSession
 	model       *genai.GenerativeModel
-	logger      *slog.Logger
+	modelName   string
+	// systemPrompt is set to the model as the system instruction
+	systemPrompt string
+	logger       *slog.Logger
 }
 
-func NewGeminiAgent(client *genai.Client, logger *slog.Logger) Agent {
+func NewGeminiAgent(client *genai.Client, systemPrompt string, logger *slog.Logger) Agent {
 	return &GeminiAgent{
-		client: client,
-		logger: logger,
+		client:       client,
+		systemPrompt: systemPrompt,
+		logger:       logger,
 	}
 }
 
 func (a *GeminiAgent) CreateRefactoringTarget(ctx context.Context, prompt string, modelName string, temperature float32) (*RefactoringTarget, error) {
-	model := a.client.GenerativeModel(modelName)
-	model.Temperature = &temperature
-
-	tool := &genai.Tool{
-		FunctionDeclarations: []*genai.FunctionDeclaration{
-			{
-				Name:        functionName,
-				Description: functionDescription,
-				Parameters: &genai.Schema{
-					Type: genai.TypeObject,
-					Properties: map[string]*genai.Schema{
-						functionParameter1Name: {
-							Type:        genai.TypeArray,
-							Description: functionParameter1Description,
-							Items: &genai.Schema{
-								Type: genai.TypeString,
-							},
-						},
-						functionParameter2Name: {
-							Type:        genai.TypeArray,
-							Description: functionParameter2Description,
-							Items: &genai.Schema{
-								Type: genai.TypeString,
-							},
-						},
-					},
-					Required: []string{functionParameter1Name, functionParameter2Name},
-				},
-			},
-		},
-	}
-	model.Tools = []*genai.Tool{tool}
-	//model.ToolConfig = &genai.ToolConfig{
-	//	FunctionCallingConfig: &genai.FunctionCallingConfig{
-	//		Mode: genai.FunctionCallingAuto,
-	//	},
-	//}
-
-	a.model = model
-	chatSession := model.StartChat()
+	a.SetModel(modelName, temperature)
+	chatSession := a.model.StartChat()
 	resp, err := chatSession.SendMessage(ctx, genai.Text(prompt))
 	if err != nil {
 		return nil, err
@@ -81,7 +85,13 @@ func (a *GeminiAgent) CreateRefactoringTarget(ctx context.Context, prompt string
 		UserPrompt: prompt,
 		ToolCallID: "",
 	}
+	called := false
 	for _, functionCall := range functionCalls {
+		if functionCall.Name != functionName {
+			a.logger.Debug("Skip an unknown function call", slog.String("name", functionCall.Name))
+			continue
+		}
+		called = true
 		var tmp RefactoringTarget
 		for name, value := range functionCall.Args {
 			switch name {
@@ -116,10 +126,58 @@ func (a *GeminiAgent) CreateRefactoringTarget(ctx context.Context, prompt string
 		target.PullRequestURLs = append(target.PullRequestURLs, tmp.PullRequestURLs...)
 		target.Files = append(target.Files, tmp.Files...)
 	}
+	if !called {
+		return nil, fmt.Errorf("no function call of %s in response", functionName)
+	}
 
 	return target.Unique(), nil
 }
 
+func (a *GeminiAgent) SetModel(modelName string, temperature float32) {
+	a.modelName = trimProviderName(modelName, geminiProviderName)
+	model := a.client.GenerativeModel(a.modelName)
+	model.Temperature = &temperature
+	if a.systemPrompt != "" {
+		model.SystemInstruction = genai.NewUserContent(genai.Text(a.systemPrompt))
+	}
+
+	tool := &genai.Tool{
+		FunctionDeclarations: []*genai.FunctionDeclaration{
+			{
+				Name:        functionName,
+				Description: functionDescription,
+				Parameters: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						functionParameter1Name: {
+							Type:        genai.TypeArray,
+							Description: functionParameter1Description,
+							Items: &genai.Schema{
+								Type: genai.TypeString,
+							},
+						},
+						functionParameter2Name: {
+							Type:        genai.TypeArray,
+							Description: functionParameter2Description,
+							Items: &genai.Schema{
+								Type: genai.TypeString,
+							},
+						},
+					},
+					Required: []string{functionParameter1Name, functionParameter2Name},
+				},
+			},
+		},
+	}
+	model.Tools = []*genai.Tool{tool}
+	//model.ToolConfig = &genai.ToolConfig{
+	//	FunctionCallingConfig: &genai.FunctionCallingConfig{
+	//		Mode: genai.FunctionCallingAuto,
+	//	},
+	//}
+	a.model = model
+}
+
 func (a *GeminiAgent) CreateRefactoringResult(ctx context.Context, req *RefactoringRequest) (*RefactoringResult, error) {
 	assistanceMessage, err := req.CreateAssistanceMessage()
 	if err != nil {
@@ -139,14 +197,44 @@ func (a *GeminiAgent) CreateRefactoringResult(ctx context.Context, req *Refactor
 	//	genai.Text(assistanceMessage),
 	//)
 
+	if a.chatSession == nil {
+		// No function call to respond since RefactoringTarget is given explicitly
+		chatSession := a.newResultChatSession()
+		resp, err := chatSession.SendMessage(ctx, genai.Text(req.UserPrompt), genai.Text(assistanceMessage))
+		if err != nil {
+			return nil, err
+		}
+		return a.parseResultResponse(resp, chatSession)
+	}
+
 	// Pattern 3
+	pullRequests := make([]any, len(req.PullRequests))
+	for i, pr := range req.PullRequests {
+		comments := make([]any, len(pr.Comments))
+		for j, c := range pr.Comments {
+			comments[j] = map[string]any{
+				"author": c.Author,
+				"body":   c.Body,
+				"path":   c.Path,
+				"line":   c.Line,
+			}
+		}
+		pullRequests[i] = map[string]any{
+			"url":      pr.URL,
+			"title":    pr.Title,
+			"body":     pr.Body,
+			"diff":     pr.Diff,
+			"comments": comments,
+		}
+	}
 	functionResponse := map[string]any{
-		"pullRequestDiff": req.PullRequests[0].Diff,
+		"pullRequests": pullRequests,
 	}
 	for _, f := range req.TargetFiles {
 		functionResponse[f.Path] = f.Content
 	}
-	resp, err := a.chatSession.SendMessage(
+	chatSession := a.newResultChatSession()
+	resp, err := chatSession.SendMessage(
 		ctx,
 		genai.Text(req.UserPrompt),
 		genai.Text(assistanceMessage),
@@ -155,18 +243,137 @@ func (a *GeminiAgent) CreateRefactoringResult(ctx context.Context, req *Refactor
 			Response: functionResponse,
 		},
 	)
+	if err != nil {
+		return nil, err
+	}
+	return a.parseResultResponse(resp, chatSession)
+}
 
+func (a *GeminiAgent) RepairRefactoringResult(ctx context.Context, req *RepairRequest) (*RefactoringResult, error) {
+	chatSession, ok := req.Previous.conversation.(*genai.ChatSession)
+	if !ok {
+		return nil, errNoConversation
+	}
+	repairMessage, err := req.CreateRepairMessage()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create repair message: %w", err)
+	}
+
+	// Continue the conversation in a copy of the session to keep the previous result as is
+	repairSession := a.newResultChatSession()
+	repairSession.History = slices.Clone(chatSession.History)
+	resp, err := repairSession.SendMessage(
+		ctx,
+		&genai.FunctionResponse{
+			Name: resultFunctionName,
+			Response: map[string]any{
+				"error": repairMessage,
+			},
+		},
+	)
 	if err != nil {
 		return nil, err
 	}
+	return a.parseResultResponse(resp, repairSession)
+}
+
+// newResultChatSession creates a new chat session which continues the conversation of CreateRefactoringTarget if any,
+// and is forced to call the result function to receive the result as structured output. The result function is declared
+// only in this session so that CreateRefactoringTarget isn't answered with it.
+// A new session is created for each result because ChatSession is not safe for concurrent use.
+func (a *GeminiAgent) newResultChatSession() *genai.ChatSession {
+	model := a.client.GenerativeModel(a.modelName)
+	model.GenerationConfig = a.model.GenerationConfig
+	model.SystemInstruction = a.model.SystemInstruction
+	// Copy the tools not to add the result function to the model of CreateRefactoringTarget
+	var declarations []*genai.FunctionDeclaration
+	for _, t := range a.model.Tools {
+		declarations = append(declarations, t.FunctionDeclarations...)
+	}
+	declarations = append(declarations, a.getResultFunctionDeclaration())
+	model.Tools = []*genai.Tool{{FunctionDeclarations: declarations}}
+	model.ToolConfig = &genai.ToolConfig{
+		FunctionCallingConfig: &genai.FunctionCallingConfig{
+			Mode:                 genai.FunctionCallingAny,
+			AllowedFunctionNames: []string{resultFunctionName},
+		},
+	}
+	chatSession := model.StartChat()
+	if a.chatSession != nil {
+		chatSession.History = slices.Clone(a.chatSession.History)
+	}
+	return chatSession
+}
+
+func (a *GeminiAgent) parseResultResponse(resp *genai.GenerateContentResponse, chatSession *genai.ChatSession) (*RefactoringResult, error) {
 	for _, c := range resp.Candidates {
+		if c.Content == nil {
+			continue
+		}
 		for i, p := range c.Content.Parts {
 			a.logger.Debug("candidates", slog.Int("index", int(c.Index)), slog.Int("partIndex", i), slog.Any("part", p))
 		}
 	}
-	//fmt.Printf("----- response -----\n%v", resp.Candidates[0].Content.Parts[0])
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return nil, fmt.Errorf("no candicates in response")
+	}
+
+	result := &RefactoringResult{
+		conversation: chatSession,
+	}
+	for _, p := range resp.Candidates[0].Content.Parts {
+		switch p := p.(type) {
+		case genai.Text:
+			result.RawContent += string(p)
+		case genai.FunctionCall:
+			if p.Name != resultFunctionName {
+				continue
+			}
+			args, err := json.Marshal(p.Args)
+			if err != nil {
+				return nil, fmt.Errorf("failed to json.Marshal: %w", err)
+			}
+			files, err := parseResultFunctionArguments(args)
+			if err != nil {
+				return nil, err
+			}
+			result.Files = append(result.Files, files...)
+		}
+	}
+	return result, nil
+}
 
-	return &RefactoringResult{
-		RawContent: fmt.Sprint(resp.Candidates[0].Content.Parts[0]),
-	}, nil
+func (a *GeminiAgent) getResultFunctionDeclaration() *genai.FunctionDeclaration {
+	return &genai.FunctionDeclaration{
+		Name:        resultFunctionName,
+		Description: resultFunctionDescription,
+		Parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				resultFunctionParameterName: {
+					Type:        genai.TypeArray,
+					Description: resultFunctionParameterDescription,
+					Items: &genai.Schema{
+						Type: genai.TypeObject,
+						Properties: map[string]*genai.Schema{
+							resultFileParameterPath: {
+								Type:        genai.TypeString,
+								Description: resultFileParameterPathDescription,
+							},
+							resultFileParameterContent: {
+								Type:        genai.TypeString,
+								Description: resultFileParameterContentDescription,
+							},
+							resultFileParameterExplanation: {
+								Type:        genai.TypeString,
+								Description: resultFileParameterExplanationDescription,
+							},
+						},
+						Required: []string{resultFileParameterPath, resultFileParameterContent, resultFileParameterExplanation},
+					},
+				},
+			},
+			Required: []string{resultFunctionParameterName},
+		},
+	}
 }
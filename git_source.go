@@ -0,0 +1,146 @@
+package corefactorer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// gitReferencePrefix is a prefix of a reference to commits in the local repository like `git:HEAD~1` or `git:abc123..def456`.
+	gitReferencePrefix = "git:"
+)
+
+// GitSource is a ReferenceSource of commits in the local git repository and local patch files.
+// It doesn't require network access.
+type GitSource struct {
+	// dir is a directory in the repository where git commands run. The current directory is used if empty.
+	dir string
+}
+
+func NewGitSource(dir string) *GitSource {
+	return &GitSource{dir: dir}
+}
+
+// Match reports whether the reference is `git:<revision>`, `git:<revision range>` or a path of `.patch`/`.diff` file.
+func (s *GitSource) Match(ref string) bool {
+	return isGitReference(ref) || isPatchFileReference(ref)
+}
+
+// Fetch creates PullRequest from the commits or the patch file.
+// For a single commit, the title and body are the subject and body of the commit message.
+// For a range, the title is the range and the body lists the subjects of the commits in the range.
+func (s *GitSource) Fetch(ctx context.Context, ref string) (*PullRequest, error) {
+	if isPatchFileReference(ref) {
+		return s.fetchPatchFile(ref)
+	}
+
+	rev, err := parseGitReference(ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse git reference '%s': %w", ref, err)
+	}
+	if strings.Contains(rev, "..") {
+		diff, err := s.git(ctx, "diff", "--no-color", "--no-ext-diff", rev, "--")
+		if err != nil {
+			return nil, fmt.Errorf("failed to get a diff of '%s': %w", ref, err)
+		}
+		log, err := s.git(ctx, "log", "--no-color", "--reverse", "--format=- %s", rev, "--")
+		if err != nil {
+			return nil, fmt.Errorf("failed to get commits of '%s': %w", ref, err)
+		}
+		return &PullRequest{
+			URL:   ref,
+			Title: "Commits in " + rev,
+			Body:  strings.TrimSpace(log),
+			Diff:  diff,
+		}, nil
+	}
+
+	subject, err := s.git(ctx, "log", "-1", "--no-color", "--format=%s", rev, "--")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit '%s': %w", ref, err)
+	}
+	body, err := s.git(ctx, "log", "-1", "--no-color", "--format=%b", rev, "--")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit '%s': %w", ref, err)
+	}
+	diff, err := s.git(ctx, "show", "--no-color", "--no-ext-diff", "--format=", rev, "--")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a diff of '%s': %w", ref, err)
+	}
+	return &PullRequest{
+		URL:   ref,
+		Title: strings.TrimSpace(subject),
+		Body:  strings.TrimSpace(body),
+		Diff:  strings.TrimLeft(diff, "\n"),
+	}, nil
+}
+
+// fetchPatchFile reads the patch file. The title is taken from `Subject:` header of `git format-patch` output
+// or the file name.
+func (s *GitSource) fetchPatchFile(path string) (*PullRequest, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read patch file '%s': %w", path, err)
+	}
+	title := filepath.Base(path)
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == "" || strings.HasPrefix(line, "diff --git ") {
+			break
+		}
+		if subject, ok := strings.CutPrefix(line, "Subject: "); ok {
+			title = strings.TrimSpace(strings.TrimPrefix(subject, "[PATCH] "))
+			break
+		}
+	}
+	return &PullRequest{
+		URL:   path,
+		Title: title,
+		Diff:  string(content),
+	}, nil
+}
+
+// git runs git command in the repository and returns its stdout.
+func (s *GitSource) git(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = s.dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to run 'git %s': %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+func isGitReference(ref string) bool {
+	return strings.HasPrefix(ref, gitReferencePrefix)
+}
+
+func isPatchFileReference(ref string) bool {
+	if strings.Contains(ref, "://") || isGitReference(ref) {
+		return false
+	}
+	ext := filepath.Ext(ref)
+	return ext == ".patch" || ext == ".diff"
+}
+
+// parseGitReference returns the revision or the revision range in `git:<revision>`.
+func parseGitReference(ref string) (string, error) {
+	rev, ok := strings.CutPrefix(ref, gitReferencePrefix)
+	if !ok {
+		return "", fmt.Errorf("reference must start with '%s'", gitReferencePrefix)
+	}
+	if rev == "" {
+		return "", fmt.Errorf("revision must not be empty")
+	}
+	// Avoid that the revision is interpreted as an option of git command
+	if strings.HasPrefix(rev, "-") || strings.ContainsAny(rev, " \t\n") {
+		return "", fmt.Errorf("invalid revision '%s'", rev)
+	}
+	return rev, nil
+}
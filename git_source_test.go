@@ -0,0 +1,118 @@
+package corefactorer
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_GitSource_Fetch(t *testing.T) {
+	dir := t.TempDir()
+	runGit := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, output)
+		}
+	}
+	writeFile := func(name string, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runGit("init", "-q")
+	writeFile("a.go", "package a\n")
+	runGit("add", "a.go")
+	runGit("commit", "-q", "-m", "Add a.go")
+	writeFile("a.go", "package a\n\nfunc A() {}\n")
+	runGit("commit", "-q", "-a", "-m", "Add A", "-m", "A is a function.")
+	writeFile("b.go", "package a\n")
+	runGit("add", "b.go")
+	runGit("commit", "-q", "-m", "Add b.go")
+	writeFile("0001-rename.patch", "From 1234 Mon Sep 17 00:00:00 2001\nSubject: [PATCH] Rename A to B\n\ndiff --git a/a.go b/a.go\n")
+
+	tests := []struct {
+		name         string
+		ref          string
+		wantTitle    string
+		wantBody     string
+		wantDiffHave []string
+		wantDiffNot  []string
+		wantErr      bool
+	}{
+		{
+			name:         "commit",
+			ref:          "git:HEAD~1",
+			wantTitle:    "Add A",
+			wantBody:     "A is a function.",
+			wantDiffHave: []string{"diff --git a/a.go b/a.go", "+func A() {}"},
+			wantDiffNot:  []string{"b.go"},
+		},
+		{
+			name:         "range",
+			ref:          "git:HEAD~2..HEAD",
+			wantTitle:    "Commits in HEAD~2..HEAD",
+			wantBody:     "- Add A\n- Add b.go",
+			wantDiffHave: []string{"diff --git a/a.go b/a.go", "diff --git a/b.go b/b.go"},
+		},
+		{
+			name:         "patch file",
+			ref:          filepath.Join(dir, "0001-rename.patch"),
+			wantTitle:    "Rename A to B",
+			wantDiffHave: []string{"diff --git a/a.go b/a.go"},
+		},
+		{
+			name:    "unknown revision",
+			ref:     "git:unknown",
+			wantErr: true,
+		},
+		{
+			name:    "option as revision",
+			ref:     "git:--output=/tmp/x",
+			wantErr: true,
+		},
+	}
+	source := NewGitSource(dir)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !source.Match(tt.ref) {
+				t.Fatalf("Match(%q) = false", tt.ref)
+			}
+			got, err := source.Fetch(context.Background(), tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.URL != tt.ref {
+				t.Errorf("Fetch() URL = %v, want %v", got.URL, tt.ref)
+			}
+			if got.Title != tt.wantTitle {
+				t.Errorf("Fetch() Title = %v, want %v", got.Title, tt.wantTitle)
+			}
+			if got.Body != tt.wantBody {
+				t.Errorf("Fetch() Body = %v, want %v", got.Body, tt.wantBody)
+			}
+			for _, s := range tt.wantDiffHave {
+				if !strings.Contains(got.Diff, s) {
+					t.Errorf("Fetch() Diff doesn't contain %q:\n%s", s, got.Diff)
+				}
+			}
+			for _, s := range tt.wantDiffNot {
+				if strings.Contains(got.Diff, s) {
+					t.Errorf("Fetch() Diff contains %q:\n%s", s, got.Diff)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package corefactorer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	giteaTokenEnv = "GITEA_TOKEN"
+	giteaHostsEnv = "GITEA_HOSTS"
+)
+
+// ParseGiteaHost parses a host of Gitea specified as `<host>` or `<host>=<API base URL>`.
+// The token is read from `GITEA_TOKEN_<HOST>` env like GITEA_TOKEN_GITEA_EXAMPLE_COM, then falls back to GITEA_TOKEN.
+func ParseGiteaHost(s string) (*SourceHost, error) {
+	h, err := ParseSourceHost(s, giteaTokenEnv)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Gitea host: %w", err)
+	}
+	return h, nil
+}
+
+// NewGiteaHostsFromEnv returns Gitea hosts in GITEA_HOSTS env (comma separated).
+func NewGiteaHostsFromEnv() ([]*SourceHost, error) {
+	return NewSourceHostsFromEnv(giteaHostsEnv, giteaTokenEnv)
+}
+
+// GiteaSource is a ReferenceSource of pull-requests in Gitea.
+type GiteaSource struct {
+	httpClient *http.Client
+	hosts      map[string]*SourceHost
+}
+
+// NewGiteaSource creates GiteaSource. Pull-requests are allowed only on `hosts`.
+// The REST API is accessed at https://<host>/api/v1/ unless APIBaseURL is specified.
+func NewGiteaSource(httpClient *http.Client, hosts []*SourceHost) *GiteaSource {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &GiteaSource{
+		httpClient: httpClient,
+		hosts:      sourceHostsByName(hosts),
+	}
+}
+
+// Match reports whether the URL is a pull-request URL of Gitea like https://gitea.example.com/owner/repo/pulls/1.
+func (s *GiteaSource) Match(ref string) bool {
+	_, err := parseGiteaPullRequestURL(ref)
+	return err == nil
+}
+
+type giteaPullRequest struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// Fetch fetches the pull-request and its diff. It returns an error if the host is not allowed.
+func (s *GiteaSource) Fetch(ctx context.Context, prURL string) (*PullRequest, error) {
+	ref, err := parseGiteaPullRequestURL(prURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pull-request url '%s': %w", prURL, err)
+	}
+	host, ok := s.hosts[ref.Host]
+	if !ok {
+		return nil, fmt.Errorf("failed to get pull-request content '%s': Gitea host '%s' is not allowed", prURL, ref.Host)
+	}
+
+	header := http.Header{}
+	if host.Token != "" {
+		header.Set("Authorization", "token "+host.Token)
+	}
+	prPath := fmt.Sprintf("repos/%s/%s/pulls/%d", url.PathEscape(ref.Owner), url.PathEscape(ref.Repo), ref.Number)
+	body, _, err := sourceGet(ctx, s.httpClient, host.apiURL("/api/v1/", prPath), header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pull-request content '%s': %w", prURL, err)
+	}
+	var pr giteaPullRequest
+	if err := json.Unmarshal(body, &pr); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal pull-request content '%s': %w", prURL, err)
+	}
+
+	diff, _, err := sourceGet(ctx, s.httpClient, host.apiURL("/api/v1/", prPath+".diff"), header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a diff of pull-request '%s': %w", prURL, err)
+	}
+
+	return &PullRequest{
+		URL:   prURL,
+		Title: pr.Title,
+		Body:  pr.Body,
+		Diff:  string(diff),
+	}, nil
+}
+
+// parseGiteaPullRequestURL parses the given URL and returns the host, owner, repo, and number of the pull request.
+// The host is not checked here because allowed hosts are configurable. See GiteaSource.
+func parseGiteaPullRequestURL(u string) (*pullRequestRef, error) {
+	parsedURL, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	// URL is like this: https://gitea.example.com/owner/repo/pulls/16
+	if parsedURL.Scheme != "https" {
+		return nil, fmt.Errorf("URL scheme must be https")
+	}
+	if parsedURL.Hostname() == "" {
+		return nil, fmt.Errorf("URL hostname must not be empty")
+	}
+	parts := strings.Split(strings.Trim(parsedURL.Path, "/"), "/")
+	if len(parts) < 4 || parts[2] != "pulls" {
+		return nil, fmt.Errorf("URL format is incorrect")
+	}
+	number, err := strconv.Atoi(parts[3])
+	if err != nil || number <= 0 {
+		return nil, fmt.Errorf("pull-request number must be a positive integer: %s", parts[3])
+	}
+	return &pullRequestRef{
+		Host:   strings.ToLower(parsedURL.Hostname()),
+		Owner:  parts[0],
+		Repo:   parts[1],
+		Number: number,
+	}, nil
+}
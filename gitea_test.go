@@ -0,0 +1,88 @@
+package corefactorer
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func Test_parseGiteaPullRequestURL(t *testing.T) {
+	type args struct {
+		u string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    *pullRequestRef
+		wantErr bool
+	}{
+		{
+			name: "ok",
+			args: args{u: "https://gitea.example.com/oinume/co-refactorer/pulls/1"},
+			want: &pullRequestRef{Host: "gitea.example.com", Owner: "oinume", Repo: "co-refactorer", Number: 1},
+		},
+		{
+			name: "files tab",
+			args: args{u: "https://gitea.example.com/oinume/co-refactorer/pulls/2/files"},
+			want: &pullRequestRef{Host: "gitea.example.com", Owner: "oinume", Repo: "co-refactorer", Number: 2},
+		},
+		{
+			name:    "GitHub pull-request",
+			args:    args{u: "https://github.com/oinume/co-refactorer/pull/1"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseGiteaPullRequestURL(tt.args.u)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseGiteaPullRequestURL() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseGiteaPullRequestURL() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_GiteaSource_Fetch(t *testing.T) {
+	const diff = "diff --git a/a.go b/a.go\n"
+	st := &sourceFetchTest{
+		newSource: func(httpClient *http.Client, hosts []*SourceHost) ReferenceSource {
+			return NewGiteaSource(httpClient, hosts)
+		},
+		host:       "gitea.example.com",
+		apiPrefix:  "/api/v1/",
+		token:      "gitea-token",
+		authHeader: "Authorization",
+		authValue:  "token gitea-token",
+		responses: map[string]sourceTestResponse{
+			"/api/v1/repos/oinume/co-refactorer/pulls/1":      {body: `{"title":"Rename","body":"Rename a function"}`},
+			"/api/v1/repos/oinume/co-refactorer/pulls/1.diff": {body: diff},
+		},
+		cases: []sourceFetchCase{
+			{
+				name: "ok",
+				ref:  "https://gitea.example.com/oinume/co-refactorer/pulls/1",
+				want: &PullRequest{
+					URL:   "https://gitea.example.com/oinume/co-refactorer/pulls/1",
+					Title: "Rename",
+					Body:  "Rename a function",
+					Diff:  diff,
+				},
+			},
+			{
+				name:    "not found",
+				ref:     "https://gitea.example.com/oinume/co-refactorer/pulls/2",
+				wantErr: true,
+			},
+			{
+				name:    "host not allowed",
+				ref:     "https://gitea.com/oinume/co-refactorer/pulls/1",
+				wantErr: true,
+			},
+		},
+	}
+	st.run(t)
+}
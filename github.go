@@ -0,0 +1,433 @@
+package corefactorer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v65/github"
+)
+
+const (
+	githubDotComHost = "github.com"
+
+	githubTokenEnv           = "GITHUB_TOKEN"
+	githubEnterpriseTokenEnv = "GITHUB_ENTERPRISE_TOKEN"
+	githubHostsEnv           = "GITHUB_HOSTS"
+
+	githubCommentsPerPage = 100
+)
+
+// GitHubHost is a host of GitHub or GitHub Enterprise Server.
+type GitHubHost struct {
+	// Host is a hostname in pull-request URLs like github.com or github.example.com.
+	Host string
+	// APIBaseURL is a base URL of REST API. https://<Host>/api/v3/ is used for GitHub Enterprise Server if empty.
+	APIBaseURL string
+	// Token is an access token for the host.
+	Token string
+}
+
+// ParseGitHubHost parses a host specified as `<host>` or `<host>=<API base URL>`.
+// The token is read from `GITHUB_TOKEN_<HOST>` env like GITHUB_TOKEN_GITHUB_EXAMPLE_COM,
+// then falls back to GITHUB_TOKEN for github.com and GITHUB_ENTERPRISE_TOKEN for the others.
+func ParseGitHubHost(s string) (*GitHubHost, error) {
+	host, apiBaseURL, err := parseHostSpec(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub host: %w", err)
+	}
+
+	token := os.Getenv(hostTokenEnv(githubTokenEnv, host))
+	if token == "" {
+		if host == githubDotComHost {
+			token = os.Getenv(githubTokenEnv)
+		} else {
+			token = os.Getenv(githubEnterpriseTokenEnv)
+		}
+	}
+	return &GitHubHost{
+		Host:       host,
+		APIBaseURL: apiBaseURL,
+		Token:      token,
+	}, nil
+}
+
+// NewGitHubHostsFromEnv returns github.com and GitHub Enterprise Server hosts in GITHUB_HOSTS env (comma separated).
+func NewGitHubHostsFromEnv() ([]*GitHubHost, error) {
+	hosts := []string{githubDotComHost}
+	if v := os.Getenv(githubHostsEnv); v != "" {
+		hosts = append(hosts, strings.Split(v, ",")...)
+	}
+	githubHosts := make([]*GitHubHost, 0, len(hosts))
+	for _, h := range hosts {
+		gh, err := ParseGitHubHost(h)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", githubHostsEnv, err)
+		}
+		githubHosts = append(githubHosts, gh)
+	}
+	return githubHosts, nil
+}
+
+// NewClient creates github.Client for the host.
+func (h *GitHubHost) NewClient(httpClient *http.Client) (*github.Client, error) {
+	c := github.NewClient(httpClient)
+	if h.Token != "" {
+		c = c.WithAuthToken(h.Token)
+	}
+	if h.Host == githubDotComHost && h.APIBaseURL == "" {
+		return c, nil
+	}
+
+	apiBaseURL := h.APIBaseURL
+	if apiBaseURL == "" {
+		apiBaseURL = "https://" + h.Host + "/api/v3/"
+	}
+	c, err := c.WithEnterpriseURLs(apiBaseURL, apiBaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set API base URL of %s: %w", h.Host, err)
+	}
+	return c, nil
+}
+
+// GitHubClients is a set of github.Client keyed by host. Pull-requests are allowed only on these hosts.
+type GitHubClients map[string]*github.Client
+
+// NewGitHubClients creates github.Client for each host. A latter host takes precedence over the former for the same host.
+func NewGitHubClients(httpClient *http.Client, hosts []*GitHubHost) (GitHubClients, error) {
+	clients := make(GitHubClients, len(hosts))
+	for _, h := range hosts {
+		c, err := h.NewClient(httpClient)
+		if err != nil {
+			return nil, err
+		}
+		clients[h.Host] = c
+	}
+	return clients, nil
+}
+
+// Get returns github.Client for the host. It returns an error if the host is not allowed.
+func (gc GitHubClients) Get(host string) (*github.Client, error) {
+	c, ok := gc[strings.ToLower(host)]
+	if !ok {
+		hosts := make([]string, 0, len(gc))
+		for h := range gc {
+			hosts = append(hosts, h)
+		}
+		slices.Sort(hosts)
+		return nil, fmt.Errorf("GitHub host '%s' is not allowed (allowed hosts: %s)", host, strings.Join(hosts, ", "))
+	}
+	return c, nil
+}
+
+// GitHubSource is a ReferenceSource of pull-requests, commits and comparisons in GitHub and GitHub Enterprise Server.
+type GitHubSource struct {
+	clients GitHubClients
+	// includeComments is whether review comments and issue comments on pull-requests are fetched
+	includeComments bool
+}
+
+func NewGitHubSource(clients GitHubClients, includeComments bool) *GitHubSource {
+	return &GitHubSource{
+		clients:         clients,
+		includeComments: includeComments,
+	}
+}
+
+// Match reports whether the URL is a pull-request URL like https://github.com/oinume/path-shrinker/pull/16,
+// a commit URL like https://github.com/oinume/path-shrinker/commit/<sha>
+// or a compare URL like https://github.com/oinume/path-shrinker/compare/<base>...<head>.
+// Only the configured hosts are matched since a commit URL and a compare URL of other sources like Gitea have the same format.
+func (s *GitHubSource) Match(ref string) bool {
+	host, ok := gitHubReferenceHost(ref)
+	if !ok {
+		return false
+	}
+	_, ok = s.clients[host]
+	return ok
+}
+
+// Fetch fetches the pull-request, commit or comparison and its diff. It returns an error if the host is not allowed.
+func (s *GitHubSource) Fetch(ctx context.Context, u string) (*PullRequest, error) {
+	if ref, err := parseGitHubCommitURL(u); err == nil {
+		return s.fetchCommit(ctx, u, ref)
+	}
+	if ref, err := parseGitHubCompareURL(u); err == nil {
+		return s.fetchComparison(ctx, u, ref)
+	}
+	return s.fetchPullRequest(ctx, u)
+}
+
+// fetchPullRequest fetches the pull-request and its diff.
+func (s *GitHubSource) fetchPullRequest(ctx context.Context, prURL string) (*PullRequest, error) {
+	ref, err := parsePullRequestURL(prURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pull-request url '%s': %w", prURL, err)
+	}
+	githubClient, err := s.clients.Get(ref.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pull-request content '%s': %w", prURL, err)
+	}
+	pr, _, err := githubClient.PullRequests.Get(ctx, ref.Owner, ref.Repo, ref.Number)
+	if err != nil {
+		// TODO: More readable error message like `failed to retrieve the pull-request. You may not have permission to access it.`
+		return nil, fmt.Errorf("failed to get pull-request content '%s': %w", prURL, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pr.GetURL(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to NewRequestWithContext: %w", err)
+	}
+	req.Header.Add("Accept", "application/vnd.github.diff")
+	// Use `Client()` to add authentication header in request
+	resp, err := githubClient.Client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to Do HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body) // Read the response body even if the status code is not 200.
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get a diff of pull-request '%s': status code from GitHub is %d: %s", pr.GetURL(), resp.StatusCode, string(body))
+	}
+
+	var comments []*PullRequestComment
+	if s.includeComments {
+		comments, err = s.fetchPullRequestComments(ctx, githubClient, ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get comments of pull-request '%s': %w", prURL, err)
+		}
+	}
+
+	return &PullRequest{
+		URL:      prURL,
+		Title:    pr.GetTitle(),
+		Body:     pr.GetBody(),
+		Diff:     string(body),
+		Comments: comments,
+	}, nil
+}
+
+// fetchPullRequestComments fetches review comments and issue comments on the pull-request sorted by created time.
+// Comments by bots are excluded since they are usually not related to the intent of the change.
+func (s *GitHubSource) fetchPullRequestComments(
+	ctx context.Context,
+	githubClient *github.Client,
+	ref *pullRequestRef,
+) ([]*PullRequestComment, error) {
+	type comment struct {
+		createdAt time.Time
+		*PullRequestComment
+	}
+	var comments []*comment
+	add := func(user *github.User, createdAt github.Timestamp, c *PullRequestComment) {
+		if user.GetType() == "Bot" || strings.TrimSpace(c.Body) == "" {
+			return
+		}
+		c.Author = user.GetLogin()
+		comments = append(comments, &comment{createdAt: createdAt.Time, PullRequestComment: c})
+	}
+
+	reviewOpts := &github.PullRequestListCommentsOptions{ListOptions: github.ListOptions{PerPage: githubCommentsPerPage}}
+	for {
+		reviewComments, resp, err := githubClient.PullRequests.ListComments(ctx, ref.Owner, ref.Repo, ref.Number, reviewOpts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list review comments: %w", err)
+		}
+		for _, c := range reviewComments {
+			line := c.GetLine()
+			if line == 0 {
+				line = c.GetOriginalLine()
+			}
+			add(c.GetUser(), c.GetCreatedAt(), &PullRequestComment{
+				Body: c.GetBody(),
+				Path: c.GetPath(),
+				Line: line,
+			})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		reviewOpts.Page = resp.NextPage
+	}
+
+	issueOpts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: githubCommentsPerPage}}
+	for {
+		issueComments, resp, err := githubClient.Issues.ListComments(ctx, ref.Owner, ref.Repo, ref.Number, issueOpts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list issue comments: %w", err)
+		}
+		for _, c := range issueComments {
+			add(c.GetUser(), c.GetCreatedAt(), &PullRequestComment{
+				Body: c.GetBody(),
+			})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		issueOpts.Page = resp.NextPage
+	}
+
+	slices.SortStableFunc(comments, func(a, b *comment) int {
+		return a.createdAt.Compare(b.createdAt)
+	})
+	retVal := make([]*PullRequestComment, len(comments))
+	for i, c := range comments {
+		retVal[i] = c.PullRequestComment
+	}
+	return retVal, nil
+}
+
+// fetchCommit fetches the commit and its diff. The title and body are the subject and body of the commit message.
+func (s *GitHubSource) fetchCommit(ctx context.Context, commitURL string, ref *gitHubRevisionRef) (*PullRequest, error) {
+	githubClient, err := s.clients.Get(ref.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit '%s': %w", commitURL, err)
+	}
+	commit, _, err := githubClient.Repositories.GetCommit(ctx, ref.Owner, ref.Repo, ref.Head, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit '%s': %w", commitURL, err)
+	}
+	// Accept header of diff is set in GetCommitRaw
+	diff, _, err := githubClient.Repositories.GetCommitRaw(ctx, ref.Owner, ref.Repo, ref.Head, github.RawOptions{Type: github.Diff})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a diff of commit '%s': %w", commitURL, err)
+	}
+
+	title, body, _ := strings.Cut(commit.GetCommit().GetMessage(), "\n")
+	return &PullRequest{
+		URL:   commitURL,
+		Title: strings.TrimSpace(title),
+		Body:  strings.TrimSpace(body),
+		Diff:  diff,
+	}, nil
+}
+
+// fetchComparison fetches the comparison between two commits and its diff. The body lists the subjects of the commits.
+func (s *GitHubSource) fetchComparison(ctx context.Context, compareURL string, ref *gitHubRevisionRef) (*PullRequest, error) {
+	githubClient, err := s.clients.Get(ref.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comparison '%s': %w", compareURL, err)
+	}
+	comparison, _, err := githubClient.Repositories.CompareCommits(ctx, ref.Owner, ref.Repo, ref.Base, ref.Head, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comparison '%s': %w", compareURL, err)
+	}
+	// Accept header of diff is set in CompareCommitsRaw
+	diff, _, err := githubClient.Repositories.CompareCommitsRaw(ctx, ref.Owner, ref.Repo, ref.Base, ref.Head, github.RawOptions{Type: github.Diff})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a diff of comparison '%s': %w", compareURL, err)
+	}
+
+	subjects := make([]string, 0, len(comparison.Commits))
+	for _, c := range comparison.Commits {
+		subject, _, _ := strings.Cut(c.GetCommit().GetMessage(), "\n")
+		subjects = append(subjects, "- "+subject)
+	}
+	return &PullRequest{
+		URL:   compareURL,
+		Title: fmt.Sprintf("Comparison between %s and %s", ref.Base, ref.Head),
+		Body:  strings.Join(subjects, "\n"),
+		Diff:  diff,
+	}, nil
+}
+
+// gitHubRevisionRef is a reference to a commit or a comparison between two commits in GitHub.
+type gitHubRevisionRef struct {
+	Host  string
+	Owner string
+	Repo  string
+	// Base is a base of the comparison. It's empty for a commit.
+	Base string
+	// Head is a SHA of the commit or a head of the comparison.
+	Head string
+}
+
+// isGitHubReferenceURL reports whether the URL is a pull-request, commit or compare URL of GitHub. The host is not checked.
+func isGitHubReferenceURL(u string) bool {
+	_, ok := gitHubReferenceHost(u)
+	return ok
+}
+
+// gitHubReferenceHost returns the lower-cased host of a pull-request, commit or compare URL of GitHub.
+func gitHubReferenceHost(u string) (string, bool) {
+	if pr, err := parsePullRequestURL(u); err == nil {
+		return pr.Host, true
+	}
+	if ref, err := parseGitHubCommitURL(u); err == nil {
+		return ref.Host, true
+	}
+	if ref, err := parseGitHubCompareURL(u); err == nil {
+		return ref.Host, true
+	}
+	return "", false
+}
+
+// parseGitHubCommitURL parses a commit URL like https://github.com/oinume/path-shrinker/commit/<sha>.
+func parseGitHubCommitURL(u string) (*gitHubRevisionRef, error) {
+	host, parts, err := splitGitHubURL(u, "commit")
+	if err != nil {
+		return nil, err
+	}
+	sha := parts[3]
+	if len(parts) != 4 || sha == "" || strings.HasPrefix(sha, "-") {
+		return nil, fmt.Errorf("commit SHA is incorrect")
+	}
+	return &gitHubRevisionRef{
+		Host:  host,
+		Owner: parts[0],
+		Repo:  parts[1],
+		Head:  sha,
+	}, nil
+}
+
+// parseGitHubCompareURL parses a compare URL like https://github.com/oinume/path-shrinker/compare/<base>...<head>.
+// A branch name can contain slashes and the two-dot notation `<base>..<head>` is also accepted.
+func parseGitHubCompareURL(u string) (*gitHubRevisionRef, error) {
+	host, parts, err := splitGitHubURL(u, "compare")
+	if err != nil {
+		return nil, err
+	}
+	revisions := strings.Join(parts[3:], "/")
+	base, head, ok := strings.Cut(revisions, "...")
+	if !ok {
+		base, head, ok = strings.Cut(revisions, "..")
+	}
+	if !ok || base == "" || head == "" {
+		return nil, fmt.Errorf("compare URL must be <base>...<head> format")
+	}
+	return &gitHubRevisionRef{
+		Host:  host,
+		Owner: parts[0],
+		Repo:  parts[1],
+		Base:  base,
+		Head:  head,
+	}, nil
+}
+
+// splitGitHubURL returns the host and the path parts of the URL like `<owner>/<repo>/<kind>/...`.
+func splitGitHubURL(u string, kind string) (string, []string, error) {
+	parsedURL, err := url.Parse(u)
+	if err != nil {
+		return "", nil, err
+	}
+	if parsedURL.Scheme != "https" {
+		return "", nil, fmt.Errorf("URL scheme must be https")
+	}
+	if parsedURL.Hostname() == "" {
+		return "", nil, fmt.Errorf("URL hostname must not be empty")
+	}
+	parts := strings.Split(strings.Trim(parsedURL.Path, "/"), "/")
+	if len(parts) < 4 || parts[2] != kind {
+		return "", nil, fmt.Errorf("URL format is incorrect")
+	}
+	return strings.ToLower(parsedURL.Hostname()), parts, nil
+}
@@ -0,0 +1,244 @@
+package corefactorer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_ParseGitHubHost(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "github-token")
+	t.Setenv("GITHUB_ENTERPRISE_TOKEN", "enterprise-token")
+	t.Setenv("GITHUB_TOKEN_GHE_EXAMPLE_COM", "ghe-token")
+
+	type args struct {
+		s string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    *GitHubHost
+		wantErr bool
+	}{
+		{
+			name: "github.com",
+			args: args{s: "github.com"},
+			want: &GitHubHost{Host: "github.com", Token: "github-token"},
+		},
+		{
+			name: "GitHub Enterprise Server",
+			args: args{s: "GitHub.example.com"},
+			want: &GitHubHost{Host: "github.example.com", Token: "enterprise-token"},
+		},
+		{
+			name: "with API base URL and token for the host",
+			args: args{s: "ghe.example.com=https://api.ghe.example.com/"},
+			want: &GitHubHost{Host: "ghe.example.com", APIBaseURL: "https://api.ghe.example.com/", Token: "ghe-token"},
+		},
+		{
+			name:    "URL instead of host",
+			args:    args{s: "https://github.example.com"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid API base URL",
+			args:    args{s: "github.example.com=api"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseGitHubHost(tt.args.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseGitHubHost() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseGitHubHost() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseGitHubCompareURL(t *testing.T) {
+	type args struct {
+		u string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    *gitHubRevisionRef
+		wantErr bool
+	}{
+		{
+			name: "three dots",
+			args: args{u: "https://github.com/oinume/co-refactorer/compare/main...feature/rename"},
+			want: &gitHubRevisionRef{Host: "github.com", Owner: "oinume", Repo: "co-refactorer", Base: "main", Head: "feature/rename"},
+		},
+		{
+			name: "two dots",
+			args: args{u: "https://github.com/oinume/co-refactorer/compare/abc123..def456"},
+			want: &gitHubRevisionRef{Host: "github.com", Owner: "oinume", Repo: "co-refactorer", Base: "abc123", Head: "def456"},
+		},
+		{
+			name:    "no base",
+			args:    args{u: "https://github.com/oinume/co-refactorer/compare/feature"},
+			wantErr: true,
+		},
+		{
+			name:    "commit URL",
+			args:    args{u: "https://github.com/oinume/co-refactorer/commit/abc123"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseGitHubCompareURL(tt.args.u)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseGitHubCompareURL() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseGitHubCompareURL() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_GitHubSource_Fetch(t *testing.T) {
+	const diff = "diff --git a/a.go b/a.go\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		isDiff := strings.Contains(r.Header.Get("Accept"), "diff")
+		switch r.URL.Path {
+		case "/api/v3/repos/oinume/co-refactorer/commits/abc123":
+			if isDiff {
+				_, _ = io.WriteString(w, diff)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, `{"sha":"abc123","commit":{"message":"Migrate to slog\n\nReplace log with slog."}}`)
+		case "/api/v3/repos/oinume/co-refactorer/compare/main...feature":
+			if isDiff {
+				_, _ = io.WriteString(w, diff)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, `{"commits":[{"commit":{"message":"Add A\n\nbody"}},{"commit":{"message":"Add B"}}]}`)
+		case "/api/v3/repos/oinume/co-refactorer/pulls/1":
+			if isDiff {
+				_, _ = io.WriteString(w, diff)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprintf(w, `{"url":"http://%s/api/v3/repos/oinume/co-refactorer/pulls/1","title":"Wrap errors","body":"Use %%w"}`, r.Host)
+		case "/api/v3/repos/oinume/co-refactorer/pulls/1/comments":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, `[{"body":"Always wrap errors with %w here","path":"a.go","line":10,"user":{"login":"alice","type":"User"},"created_at":"2024-01-02T00:00:00Z"}]`)
+		case "/api/v3/repos/oinume/co-refactorer/issues/1/comments":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, `[{"body":"Why not errors.Join?","user":{"login":"bob","type":"User"},"created_at":"2024-01-01T00:00:00Z"},{"body":"Coverage report","user":{"login":"ci[bot]","type":"Bot"},"created_at":"2024-01-03T00:00:00Z"}]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	clients, err := NewGitHubClients(server.Client(), []*GitHubHost{
+		{Host: "github.example.com", APIBaseURL: server.URL + "/api/v3/"},
+	})
+	if err != nil {
+		t.Fatalf("NewGitHubClients() error = %v", err)
+	}
+	source := NewGitHubSource(clients, true)
+	tests := []struct {
+		name    string
+		u       string
+		want    *PullRequest
+		wantErr bool
+	}{
+		{
+			name: "commit",
+			u:    "https://github.example.com/oinume/co-refactorer/commit/abc123",
+			want: &PullRequest{
+				URL:   "https://github.example.com/oinume/co-refactorer/commit/abc123",
+				Title: "Migrate to slog",
+				Body:  "Replace log with slog.",
+				Diff:  diff,
+			},
+		},
+		{
+			name: "compare",
+			u:    "https://github.example.com/oinume/co-refactorer/compare/main...feature",
+			want: &PullRequest{
+				URL:   "https://github.example.com/oinume/co-refactorer/compare/main...feature",
+				Title: "Comparison between main and feature",
+				Body:  "- Add A\n- Add B",
+				Diff:  diff,
+			},
+		},
+		{
+			name: "pull-request with comments",
+			u:    "https://github.example.com/oinume/co-refactorer/pull/1",
+			want: &PullRequest{
+				URL:   "https://github.example.com/oinume/co-refactorer/pull/1",
+				Title: "Wrap errors",
+				Body:  "Use %w",
+				Diff:  diff,
+				Comments: []*PullRequestComment{
+					{Author: "bob", Body: "Why not errors.Join?"},
+					{Author: "alice", Body: "Always wrap errors with %w here", Path: "a.go", Line: 10},
+				},
+			},
+		},
+		{
+			name:    "unknown commit",
+			u:       "https://github.example.com/oinume/co-refactorer/commit/def456",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !source.Match(tt.u) {
+				t.Fatalf("Match(%q) = false", tt.u)
+			}
+			got, err := source.Fetch(context.Background(), tt.u)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Fetch() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_GitHubSource_Match(t *testing.T) {
+	clients, err := NewGitHubClients(http.DefaultClient, []*GitHubHost{{Host: "github.com"}, {Host: "github.example.com"}})
+	if err != nil {
+		t.Fatalf("NewGitHubClients() error = %v", err)
+	}
+	source := NewGitHubSource(clients, false)
+	tests := map[string]struct {
+		ref  string
+		want bool
+	}{
+		"pull-request":                 {ref: "https://github.com/oinume/co-refactorer/pull/1", want: true},
+		"commit on enterprise server":  {ref: "https://GitHub.example.com/oinume/co-refactorer/commit/abc123", want: true},
+		"compare":                      {ref: "https://github.com/oinume/co-refactorer/compare/main...feature", want: true},
+		"commit on unconfigured host":  {ref: "https://gitea.example.com/oinume/co-refactorer/commit/abc123", want: false},
+		"compare on unconfigured host": {ref: "https://gitea.example.com/oinume/co-refactorer/compare/main...feature", want: false},
+		"not a reference":              {ref: "https://github.com/oinume/co-refactorer", want: false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := source.Match(tt.ref); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.ref, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package corefactorer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	gitlabDotComHost = "gitlab.com"
+
+	gitlabTokenEnv = "GITLAB_TOKEN"
+	gitlabHostsEnv = "GITLAB_HOSTS"
+
+	gitlabDiffsPerPage = 100
+)
+
+// ParseGitLabHost parses a host of GitLab specified as `<host>` or `<host>=<API base URL>`.
+// The token is read from `GITLAB_TOKEN_<HOST>` env like GITLAB_TOKEN_GITLAB_EXAMPLE_COM, then falls back to GITLAB_TOKEN.
+func ParseGitLabHost(s string) (*SourceHost, error) {
+	h, err := ParseSourceHost(s, gitlabTokenEnv)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitLab host: %w", err)
+	}
+	return h, nil
+}
+
+// NewGitLabHostsFromEnv returns gitlab.com and self-managed GitLab hosts in GITLAB_HOSTS env (comma separated).
+func NewGitLabHostsFromEnv() ([]*SourceHost, error) {
+	return NewSourceHostsFromEnv(gitlabHostsEnv, gitlabTokenEnv, gitlabDotComHost)
+}
+
+// GitLabSource is a ReferenceSource of merge requests in GitLab.
+type GitLabSource struct {
+	httpClient *http.Client
+	hosts      map[string]*SourceHost
+}
+
+// NewGitLabSource creates GitLabSource. Merge requests are allowed only on `hosts`.
+// The REST API is accessed at https://<host>/api/v4/ unless APIBaseURL is specified.
+func NewGitLabSource(httpClient *http.Client, hosts []*SourceHost) *GitLabSource {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &GitLabSource{
+		httpClient: httpClient,
+		hosts:      sourceHostsByName(hosts),
+	}
+}
+
+// Match reports whether the URL is a merge request URL like https://gitlab.com/group/project/-/merge_requests/1.
+func (s *GitLabSource) Match(ref string) bool {
+	_, err := parseMergeRequestURL(ref)
+	return err == nil
+}
+
+type gitlabMergeRequest struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+type gitlabDiff struct {
+	OldPath     string `json:"old_path"`
+	NewPath     string `json:"new_path"`
+	AMode       string `json:"a_mode"`
+	BMode       string `json:"b_mode"`
+	Diff        string `json:"diff"`
+	NewFile     bool   `json:"new_file"`
+	RenamedFile bool   `json:"renamed_file"`
+	DeletedFile bool   `json:"deleted_file"`
+}
+
+// Fetch fetches the merge request and its diff. It returns an error if the host is not allowed.
+func (s *GitLabSource) Fetch(ctx context.Context, mrURL string) (*PullRequest, error) {
+	ref, err := parseMergeRequestURL(mrURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse merge request url '%s': %w", mrURL, err)
+	}
+	host, ok := s.hosts[ref.Host]
+	if !ok {
+		return nil, fmt.Errorf("failed to get merge request content '%s': GitLab host '%s' is not allowed", mrURL, ref.Host)
+	}
+
+	mrPath := "projects/" + url.PathEscape(ref.Project) + "/merge_requests/" + strconv.Itoa(ref.Number)
+	var mr gitlabMergeRequest
+	if _, err := s.getJSON(ctx, host, mrPath, &mr); err != nil {
+		return nil, fmt.Errorf("failed to get merge request content '%s': %w", mrURL, err)
+	}
+
+	var diff strings.Builder
+	for page := "1"; page != ""; {
+		var diffs []*gitlabDiff
+		header, err := s.getJSON(ctx, host, fmt.Sprintf("%s/diffs?page=%s&per_page=%d", mrPath, page, gitlabDiffsPerPage), &diffs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get a diff of merge request '%s': %w", mrURL, err)
+		}
+		for _, d := range diffs {
+			writeGitLabDiff(&diff, d)
+		}
+		page = header.Get("X-Next-Page")
+	}
+
+	return &PullRequest{
+		URL:   mrURL,
+		Title: mr.Title,
+		Body:  mr.Description,
+		Diff:  diff.String(),
+	}, nil
+}
+
+// getJSON sends GET request to GitLab API and decodes the response body into `v`.
+func (s *GitLabSource) getJSON(ctx context.Context, host *SourceHost, path string, v any) (http.Header, error) {
+	header := http.Header{}
+	if host.Token != "" {
+		header.Set("PRIVATE-TOKEN", host.Token)
+	}
+	body, respHeader, err := sourceGet(ctx, s.httpClient, host.apiURL("/api/v4/", path), header)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response body: %w", err)
+	}
+	return respHeader, nil
+}
+
+// writeGitLabDiff writes a diff of a file in the same format as `git diff`
+// since GitLab API returns only hunks without headers.
+func writeGitLabDiff(b *strings.Builder, d *gitlabDiff) {
+	_, _ = fmt.Fprintf(b, "diff --git a/%s b/%s\n", d.OldPath, d.NewPath)
+	oldPath, newPath := "a/"+d.OldPath, "b/"+d.NewPath
+	switch {
+	case d.NewFile:
+		_, _ = fmt.Fprintf(b, "new file mode %s\n", d.BMode)
+		oldPath = "/dev/null"
+	case d.DeletedFile:
+		_, _ = fmt.Fprintf(b, "deleted file mode %s\n", d.AMode)
+		newPath = "/dev/null"
+	case d.RenamedFile:
+		_, _ = fmt.Fprintf(b, "rename from %s\nrename to %s\n", d.OldPath, d.NewPath)
+	}
+	if d.Diff == "" {
+		return
+	}
+	_, _ = fmt.Fprintf(b, "--- %s\n+++ %s\n", oldPath, newPath)
+	b.WriteString(d.Diff)
+	if !strings.HasSuffix(d.Diff, "\n") {
+		b.WriteString("\n")
+	}
+}
+
+// mergeRequestRef is a reference to a merge request in GitLab.
+type mergeRequestRef struct {
+	Host string
+	// Project is a full path of the project including groups like `group/subgroup/project`.
+	Project string
+	Number  int
+}
+
+// parseMergeRequestURL parses the given URL and returns the host, project, and number of the merge request.
+// The host is not checked here because allowed hosts are configurable. See GitLabSource.
+func parseMergeRequestURL(u string) (*mergeRequestRef, error) {
+	parsedURL, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	// URL is like this: https://gitlab.com/group/subgroup/project/-/merge_requests/16
+	if parsedURL.Scheme != "https" {
+		return nil, fmt.Errorf("URL scheme must be https")
+	}
+	if parsedURL.Hostname() == "" {
+		return nil, fmt.Errorf("URL hostname must not be empty")
+	}
+	project, rest, ok := strings.Cut(strings.Trim(parsedURL.Path, "/"), "/-/merge_requests/")
+	if !ok || project == "" || !strings.Contains(project, "/") {
+		return nil, fmt.Errorf("URL format is incorrect")
+	}
+	numberPart, _, _ := strings.Cut(rest, "/")
+	number, err := strconv.Atoi(numberPart)
+	if err != nil || number <= 0 {
+		return nil, fmt.Errorf("merge request number must be a positive integer: %s", numberPart)
+	}
+	return &mergeRequestRef{
+		Host:    strings.ToLower(parsedURL.Hostname()),
+		Project: project,
+		Number:  number,
+	}, nil
+}
@@ -0,0 +1,99 @@
+package corefactorer
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func Test_parseMergeRequestURL(t *testing.T) {
+	type args struct {
+		u string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    *mergeRequestRef
+		wantErr bool
+	}{
+		{
+			name: "ok",
+			args: args{u: "https://gitlab.com/oinume/co-refactorer/-/merge_requests/1"},
+			want: &mergeRequestRef{Host: "gitlab.com", Project: "oinume/co-refactorer", Number: 1},
+		},
+		{
+			name: "subgroup and diffs tab",
+			args: args{u: "https://gitlab.example.com/group/subgroup/project/-/merge_requests/12/diffs"},
+			want: &mergeRequestRef{Host: "gitlab.example.com", Project: "group/subgroup/project", Number: 12},
+		},
+		{
+			name:    "GitHub pull-request",
+			args:    args{u: "https://github.com/oinume/co-refactorer/pull/1"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid number",
+			args:    args{u: "https://gitlab.com/oinume/co-refactorer/-/merge_requests/new"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMergeRequestURL(tt.args.u)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseMergeRequestURL() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMergeRequestURL() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_GitLabSource_Fetch(t *testing.T) {
+	st := &sourceFetchTest{
+		newSource: func(httpClient *http.Client, hosts []*SourceHost) ReferenceSource {
+			return NewGitLabSource(httpClient, hosts)
+		},
+		host:       "gitlab.example.com",
+		apiPrefix:  "/api/v4",
+		token:      "gitlab-token",
+		authHeader: "PRIVATE-TOKEN",
+		authValue:  "gitlab-token",
+		responses: map[string]sourceTestResponse{
+			"/api/v4/projects/group%2Fproject/merge_requests/3": {body: `{"title":"Rename","description":"Rename a function"}`},
+			"/api/v4/projects/group%2Fproject/merge_requests/3/diffs?page=1": {
+				body:     `[{"old_path":"a.go","new_path":"a.go","a_mode":"100644","b_mode":"100644","diff":"@@ -1 +1 @@\n-a\n+b\n"}]`,
+				nextPage: "2",
+			},
+			"/api/v4/projects/group%2Fproject/merge_requests/3/diffs?page=2": {
+				body: `[{"old_path":"b.go","new_path":"b.go","a_mode":"0","b_mode":"100644","diff":"@@ -0,0 +1 @@\n+b","new_file":true}]`,
+			},
+		},
+		cases: []sourceFetchCase{
+			{
+				name: "ok",
+				ref:  "https://gitlab.example.com/group/project/-/merge_requests/3",
+				want: &PullRequest{
+					URL:   "https://gitlab.example.com/group/project/-/merge_requests/3",
+					Title: "Rename",
+					Body:  "Rename a function",
+					Diff: "diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n-a\n+b\n" +
+						"diff --git a/b.go b/b.go\nnew file mode 100644\n--- /dev/null\n+++ b/b.go\n@@ -0,0 +1 @@\n+b\n",
+				},
+			},
+			{
+				name:    "not found",
+				ref:     "https://gitlab.example.com/group/project/-/merge_requests/4",
+				wantErr: true,
+			},
+			{
+				name:    "host not allowed",
+				ref:     "https://gitlab.com/group/project/-/merge_requests/3",
+				wantErr: true,
+			},
+		},
+	}
+	st.run(t)
+}
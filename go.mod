@@ -4,12 +4,17 @@ go 1.23
 
 require (
 	github.com/antchfx/htmlquery v1.3.2
+	github.com/aymanbagabas/go-udiff v0.2.0
+	github.com/bmatcuk/doublestar/v4 v4.7.1
 	github.com/google/generative-ai-go v0.18.0
-	github.com/google/go-github/v64 v64.0.0
 	github.com/google/go-github/v65 v65.0.0
+	github.com/liushuangls/go-anthropic/v2 v2.8.0
 	github.com/sashabaranov/go-openai v1.30.3
 	github.com/yuin/goldmark v1.7.4
+	golang.org/x/mod v0.21.0
+	golang.org/x/tools v0.25.0
 	google.golang.org/api v0.186.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -30,7 +35,6 @@ require (
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/googleapis/enterprise-certificate-proxy v0.3.2 // indirect
 	github.com/googleapis/gax-go/v2 v2.12.5 // indirect
-	github.com/liushuangls/go-anthropic/v2 v2.8.0 // indirect
 	go.opencensus.io v0.24.0 // indirect
 	go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc v0.51.0 // indirect
 	go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.51.0 // indirect
@@ -0,0 +1,404 @@
+package corefactorer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+const (
+	ollamaProviderName   = "ollama"
+	ollamaDefaultBaseURL = "http://localhost:11434"
+	// ollamaDefaultContextWindow is sent as `num_ctx` option since the default of Ollama is too small for refactoring
+	ollamaDefaultContextWindow = 8192
+)
+
+func init() {
+	RegisterAgentProvider(&AgentProvider{
+		Name:        ollamaProviderName,
+		Description: "Local LLM served by Ollama. The endpoint is configured with " + ollamaHostEnv,
+		Models: []string{
+			"ollama/llama3.1",
+			"ollama/qwen2.5-coder",
+			"ollama/codellama",
+			"ollama/mistral",
+		},
+		// Ollama truncates the prompt to `num_ctx` option silently, so the context window is sent as `num_ctx`
+		DefaultContextWindow: ollamaDefaultContextWindow,
+		CharsPerToken:        3.5,
+		New: func(model string, config *AgentConfig, logger *slog.Logger) (Agent, error) {
+			contextWindow := config.ContextWindow
+			if contextWindow <= 0 {
+				contextWindow = ollamaDefaultContextWindow
+			}
+			return NewOllamaAgent(http.DefaultClient, os.Getenv(ollamaHostEnv), contextWindow, config.SystemPrompt, logger), nil
+		},
+	})
+}
+
+// OllamaAgent is an Agent for local LLM servers which speak Ollama's chat API (Ollama, llama.cpp with an Ollama compatible frontend, etc.).
+// It uses tool calling if the model supports it, otherwise falls back to JSON mode.
+type OllamaAgent struct {
+	httpClient *http.Client
+	baseURL    string
+	logger     *slog.Logger
+	model      string
+	// contextWindow is sent as `num_ctx` option if it's positive
+	contextWindow int
+	// systemPrompt is sent as the first message with `system` role if it's not empty
+	systemPrompt string
+	// options are options of the model like temperature which are sent in all requests
+	options map[string]any
+	// toolCalls are the tool calls in the response of CreateRefactoringTarget. Nil in JSON mode or without CreateRefactoringTarget.
+	toolCalls []ollamaToolCall
+	// jsonContent is the response content of CreateRefactoringTarget in JSON mode. Empty without CreateRefactoringTarget.
+	jsonContent string
+}
+
+func NewOllamaAgent(httpClient *http.Client, baseURL string, contextWindow int, systemPrompt string, logger *slog.Logger) Agent {
+	if baseURL == "" {
+		baseURL = ollamaDefaultBaseURL
+	}
+	if !strings.Contains(baseURL, "://") {
+		// OLLAMA_HOST is often specified as `host:port`
+		baseURL = "http://" + baseURL
+	}
+	return &OllamaAgent{
+		httpClient:    httpClient,
+		baseURL:       strings.TrimSuffix(baseURL, "/"),
+		contextWindow: contextWindow,
+		systemPrompt:  systemPrompt,
+		logger:        logger,
+	}
+}
+
+type ollamaChatRequest struct {
+	Model    string              `json:"model"`
+	Messages []ollamaChatMessage `json:"messages"`
+	Stream   bool                `json:"stream"`
+	Tools    []ollamaTool        `json:"tools,omitempty"`
+	Format   string              `json:"format,omitempty"`
+	Options  map[string]any      `json:"options,omitempty"`
+}
+
+type ollamaChatMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+}
+
+type ollamaTool struct {
+	Type     string             `json:"type"`
+	Function ollamaToolFunction `json:"function"`
+}
+
+type ollamaToolFunction struct {
+	Name        string                `json:"name"`
+	Description string                `json:"description"`
+	Parameters  jsonschema.Definition `json:"parameters"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaChatResponse struct {
+	Model   string            `json:"model"`
+	Message ollamaChatMessage `json:"message"`
+	Done    bool              `json:"done"`
+}
+
+// ollamaError is an error response from Ollama API.
+type ollamaError struct {
+	StatusCode int
+	Message    string `json:"error"`
+}
+
+func (e *ollamaError) Error() string {
+	return fmt.Sprintf("ollama API error: status code %d: %s", e.StatusCode, e.Message)
+}
+
+func (e *ollamaError) toolsNotSupported() bool {
+	return e.StatusCode == http.StatusBadRequest && strings.Contains(e.Message, "does not support tools")
+}
+
+func (a *OllamaAgent) CreateRefactoringTarget(ctx context.Context, prompt string, model string, temperature float32) (*RefactoringTarget, error) {
+	a.SetModel(model, temperature)
+	options := a.options
+	resp, err := a.chat(ctx, &ollamaChatRequest{
+		Model: a.model,
+		Messages: a.newMessages(
+			ollamaChatMessage{Role: "user", Content: prompt},
+		),
+		Tools:   []ollamaTool{a.getTool()},
+		Options: options,
+	})
+	if err != nil {
+		var oe *ollamaError
+		if !errors.As(err, &oe) || !oe.toolsNotSupported() {
+			return nil, fmt.Errorf("failed to chat: %w", err)
+		}
+		a.logger.Debug("Model doesn't support tools, falling back to JSON mode", slog.String("model", a.model))
+		return a.createRefactoringTargetWithJSON(ctx, prompt, options)
+	}
+
+	toolCalls := resp.Message.ToolCalls
+	if len(toolCalls) == 0 {
+		return nil, fmt.Errorf("no tool calls in response")
+	}
+	a.toolCalls = toolCalls
+	target := &RefactoringTarget{
+		UserPrompt: prompt,
+	}
+	for _, toolCall := range toolCalls {
+		var tmp RefactoringTarget
+		if err := json.Unmarshal(toolCall.Function.Arguments, &tmp); err != nil {
+			return nil, fmt.Errorf("failed to json.Unmarshal: %w", err)
+		}
+		target.PullRequestURLs = append(target.PullRequestURLs, tmp.PullRequestURLs...)
+		target.Files = append(target.Files, tmp.Files...)
+	}
+
+	return target.Unique(), nil
+}
+
+func (a *OllamaAgent) SetModel(model string, temperature float32) {
+	a.model = trimProviderName(model, ollamaProviderName)
+	a.options = map[string]any{"temperature": temperature}
+	if a.contextWindow > 0 {
+		a.options["num_ctx"] = a.contextWindow
+	}
+}
+
+func (a *OllamaAgent) createRefactoringTargetWithJSON(ctx context.Context, prompt string, options map[string]any) (*RefactoringTarget, error) {
+	parameters, err := json.Marshal(a.getTool().Function.Parameters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to json.Marshal: %w", err)
+	}
+	instruction := fmt.Sprintf(
+		"%s\n\nExtract the refactoring target from the message above and respond only with a JSON object which follows this JSON schema:\n%s",
+		prompt, string(parameters),
+	)
+	resp, err := a.chat(ctx, &ollamaChatRequest{
+		Model: a.model,
+		Messages: a.newMessages(
+			ollamaChatMessage{Role: "user", Content: instruction},
+		),
+		Format:  "json",
+		Options: options,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to chat: %w", err)
+	}
+
+	var target RefactoringTarget
+	if err := json.Unmarshal([]byte(resp.Message.Content), &target); err != nil {
+		return nil, fmt.Errorf("failed to json.Unmarshal: %w", err)
+	}
+	a.jsonContent = resp.Message.Content
+	target.UserPrompt = prompt
+	return target.Unique(), nil
+}
+
+func (a *OllamaAgent) CreateRefactoringResult(ctx context.Context, req *RefactoringRequest) (*RefactoringResult, error) {
+	assistanceMessage, err := req.CreateAssistanceMessage()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create assistance message: %w", err)
+	}
+
+	chatReq := &ollamaChatRequest{
+		Model: a.model,
+		Messages: a.newMessages(
+			ollamaChatMessage{Role: "user", Content: req.UserPrompt},
+		),
+		Options: a.options,
+	}
+	if len(a.toolCalls) > 0 {
+		chatReq.Messages = append(chatReq.Messages,
+			ollamaChatMessage{Role: "assistant", ToolCalls: a.toolCalls},
+			ollamaChatMessage{Role: "tool", Content: assistanceMessage},
+		)
+		chatReq.Tools = []ollamaTool{a.getResultTool()}
+	} else {
+		parameters, err := json.Marshal(resultFunctionParameters())
+		if err != nil {
+			return nil, fmt.Errorf("failed to json.Marshal: %w", err)
+		}
+		if a.jsonContent != "" {
+			chatReq.Messages = append(chatReq.Messages, ollamaChatMessage{Role: "assistant", Content: a.jsonContent})
+		}
+		chatReq.Messages = append(chatReq.Messages,
+			ollamaChatMessage{
+				Role: "user",
+				Content: fmt.Sprintf(
+					"%s\n\nRespond only with a JSON object which follows this JSON schema:\n%s",
+					assistanceMessage, string(parameters),
+				),
+			},
+		)
+		chatReq.Format = "json"
+	}
+
+	return a.createResult(ctx, chatReq)
+}
+
+// newMessages returns the messages of a new conversation starting with the system prompt.
+func (a *OllamaAgent) newMessages(messages ...ollamaChatMessage) []ollamaChatMessage {
+	if a.systemPrompt == "" {
+		return messages
+	}
+	return append([]ollamaChatMessage{{Role: "system", Content: a.systemPrompt}}, messages...)
+}
+
+func (a *OllamaAgent) RepairRefactoringResult(ctx context.Context, req *RepairRequest) (*RefactoringResult, error) {
+	conversation, ok := req.Previous.conversation.(*ollamaChatRequest)
+	if !ok || len(conversation.Messages) == 0 {
+		return nil, errNoConversation
+	}
+	repairMessage, err := req.CreateRepairMessage()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create repair message: %w", err)
+	}
+
+	chatReq := *conversation
+	chatReq.Messages = slices.Clone(conversation.Messages)
+	if len(chatReq.Messages[len(chatReq.Messages)-1].ToolCalls) > 0 {
+		chatReq.Messages = append(chatReq.Messages, ollamaChatMessage{Role: "tool", Content: repairMessage})
+	} else {
+		parameters, err := json.Marshal(resultFunctionParameters())
+		if err != nil {
+			return nil, fmt.Errorf("failed to json.Marshal: %w", err)
+		}
+		chatReq.Messages = append(chatReq.Messages, ollamaChatMessage{
+			Role: "user",
+			Content: fmt.Sprintf(
+				"%s\n\nRespond only with a JSON object which follows this JSON schema:\n%s",
+				repairMessage, string(parameters),
+			),
+		})
+	}
+	return a.createResult(ctx, &chatReq)
+}
+
+// createResult sends the chat request and receives RefactoringResult through `submitRefactoringResult` tool or JSON mode.
+func (a *OllamaAgent) createResult(ctx context.Context, chatReq *ollamaChatRequest) (*RefactoringResult, error) {
+	a.logger.Debug("API call: a.chat")
+	resp, err := a.chat(ctx, chatReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to chat: %w", err)
+	}
+
+	conversation := *chatReq
+	conversation.Messages = append(slices.Clip(chatReq.Messages), resp.Message)
+	result := &RefactoringResult{
+		RawContent:   resp.Message.Content,
+		conversation: &conversation,
+	}
+	for _, toolCall := range resp.Message.ToolCalls {
+		if toolCall.Function.Name != resultFunctionName {
+			continue
+		}
+		files, err := parseResultFunctionArguments(toolCall.Function.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		result.Files = append(result.Files, files...)
+	}
+	if len(result.Files) == 0 && chatReq.Format == "json" {
+		if files, err := parseResultFunctionArguments([]byte(resp.Message.Content)); err == nil {
+			result.Files = files
+		}
+	}
+	if len(result.Files) == 0 && result.RawContent == "" {
+		return nil, fmt.Errorf("no content in response")
+	}
+	return result, nil
+}
+
+func (a *OllamaAgent) chat(ctx context.Context, chatReq *ollamaChatRequest) (*ollamaChatResponse, error) {
+	body, err := json.Marshal(chatReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to json.Marshal: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.baseURL+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to NewRequestWithContext: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to Do HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		oe := &ollamaError{StatusCode: resp.StatusCode}
+		if err := json.Unmarshal(respBody, oe); err != nil || oe.Message == "" {
+			oe.Message = string(respBody)
+		}
+		return nil, oe
+	}
+
+	var chatResp ollamaChatResponse
+	if err := json.Unmarshal(respBody, &chatResp); err != nil {
+		return nil, fmt.Errorf("failed to json.Unmarshal: %w", err)
+	}
+	return &chatResp, nil
+}
+
+func (a *OllamaAgent) getTool() ollamaTool {
+	return ollamaTool{
+		Type: "function",
+		Function: ollamaToolFunction{
+			Name:        functionName,
+			Description: functionDescription,
+			Parameters: jsonschema.Definition{
+				Type: jsonschema.Object,
+				Properties: map[string]jsonschema.Definition{
+					functionParameter1Name: {
+						Type:        jsonschema.Array,
+						Description: functionParameter1Description,
+						Items: &jsonschema.Definition{
+							Type: jsonschema.String,
+						},
+					},
+					functionParameter2Name: {
+						Type:        jsonschema.Array,
+						Description: functionParameter2Description,
+						Items: &jsonschema.Definition{
+							Type: jsonschema.String,
+						},
+					},
+				},
+				Required: []string{functionParameter1Name, functionParameter2Name},
+			},
+		},
+	}
+}
+
+func (a *OllamaAgent) getResultTool() ollamaTool {
+	return ollamaTool{
+		Type: "function",
+		Function: ollamaToolFunction{
+			Name:        resultFunctionName,
+			Description: resultFunctionDescription,
+			Parameters:  resultFunctionParameters(),
+		},
+	}
+}
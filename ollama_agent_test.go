@@ -0,0 +1,203 @@
+package corefactorer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func Test_OllamaAgent_CreateRefactoringTarget(t *testing.T) {
+	type args struct {
+		prompt string
+		model  string
+	}
+	tests := []struct {
+		name          string
+		args          args
+		supportsTools bool
+		want          *RefactoringTarget
+		wantErr       bool
+	}{
+		{
+			name: "tool calling",
+			args: args{
+				prompt: "Refactor a.go by referring to https://github.com/oinume/co-refactorer/pull/9",
+				model:  "ollama/llama3.1",
+			},
+			supportsTools: true,
+			want: &RefactoringTarget{
+				UserPrompt:      "Refactor a.go by referring to https://github.com/oinume/co-refactorer/pull/9",
+				PullRequestURLs: []string{"https://github.com/oinume/co-refactorer/pull/9"},
+				Files:           []string{"a.go"},
+			},
+		},
+		{
+			name: "JSON mode fallback",
+			args: args{
+				prompt: "Refactor a.go by referring to https://github.com/oinume/co-refactorer/pull/9",
+				model:  "ollama/gemma",
+			},
+			supportsTools: false,
+			want: &RefactoringTarget{
+				UserPrompt:      "Refactor a.go by referring to https://github.com/oinume/co-refactorer/pull/9",
+				PullRequestURLs: []string{"https://github.com/oinume/co-refactorer/pull/9"},
+				Files:           []string{"a.go"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arguments := `{"pullRequestUrls":["https://github.com/oinume/co-refactorer/pull/9"],"files":["a.go"]}`
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req ollamaChatRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Errorf("failed to decode request: %v", err)
+					return
+				}
+				if req.Model == tt.args.model {
+					t.Errorf("model prefix must be trimmed: %s", req.Model)
+				}
+				switch {
+				case len(req.Tools) > 0 && !tt.supportsTools:
+					w.WriteHeader(http.StatusBadRequest)
+					_, _ = io.WriteString(w, `{"error":"registry.ollama.ai/library/gemma:latest does not support tools"}`)
+				case len(req.Tools) > 0:
+					_, _ = io.WriteString(w, `{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"extractRefactoringTarget","arguments":`+arguments+`}}]},"done":true}`)
+				default:
+					if req.Format != "json" {
+						t.Errorf("format must be json: %s", req.Format)
+					}
+					content, _ := json.Marshal(arguments)
+					_, _ = io.WriteString(w, `{"message":{"role":"assistant","content":`+string(content)+`},"done":true}`)
+				}
+			}))
+			defer server.Close()
+
+			agent := NewOllamaAgent(server.Client(), server.URL, 0, "", slog.New(slog.NewTextHandler(io.Discard, nil)))
+			got, err := agent.CreateRefactoringTarget(context.Background(), tt.args.prompt, tt.args.model, 0.7)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateRefactoringTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CreateRefactoringTarget() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_OllamaAgent_CreateRefactoringResult(t *testing.T) {
+	wantFiles := []*RefactoredFile{
+		{Path: "a.go", Content: "package main\n\nfunc main() {}\n", Explanation: "Add main function"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+			return
+		}
+		if len(req.Tools) != 1 {
+			t.Errorf("number of tools must be 1: %d", len(req.Tools))
+			return
+		}
+		if req.Tools[0].Function.Name == functionName {
+			_, _ = io.WriteString(w, `{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"extractRefactoringTarget","arguments":{"pullRequestUrls":[],"files":["a.go"]}}}]},"done":true}`)
+			return
+		}
+		if got := req.Messages[len(req.Messages)-1].Role; got != "tool" {
+			t.Errorf("last message role must be tool: %s", got)
+		}
+		arguments, _ := json.Marshal(map[string]any{"files": wantFiles})
+		_, _ = io.WriteString(w, `{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"submitRefactoringResult","arguments":`+string(arguments)+`}}]},"done":true}`)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	agent := NewOllamaAgent(server.Client(), server.URL, 0, "", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if _, err := agent.CreateRefactoringTarget(ctx, "Refactor a.go", "ollama/llama3.1", 0.7); err != nil {
+		t.Fatalf("CreateRefactoringTarget() error = %v", err)
+	}
+	got, err := agent.CreateRefactoringResult(ctx, &RefactoringRequest{
+		UserPrompt:   "Refactor a.go",
+		PullRequests: []*PullRequest{{URL: "https://github.com/oinume/co-refactorer/pull/9"}},
+		TargetFiles:  []*TargetFile{{Path: "a.go", Content: "package main\n"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateRefactoringResult() error = %v", err)
+	}
+	if !reflect.DeepEqual(got.Files, wantFiles) {
+		t.Errorf("CreateRefactoringResult() got = %v, want %v", got.Files, wantFiles)
+	}
+}
+
+func Test_OllamaAgent_CreateRefactoringResult_SetModel(t *testing.T) {
+	wantFiles := []*RefactoredFile{
+		{Path: "a.go", Content: "package main\n\nfunc main() {}\n", Explanation: "Add main function"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+			return
+		}
+		if req.Model != "llama3.1" {
+			t.Errorf("model must be llama3.1: %s", req.Model)
+		}
+		if got := req.Options["temperature"]; got != 0.5 {
+			t.Errorf("temperature must be 0.5: %v", got)
+		}
+		for _, m := range req.Messages {
+			if m.Role != "user" {
+				t.Errorf("messages must be only user messages without CreateRefactoringTarget: %s", m.Role)
+			}
+		}
+		content, _ := json.Marshal(map[string]any{"files": wantFiles})
+		message, _ := json.Marshal(ollamaChatMessage{Role: "assistant", Content: string(content)})
+		_, _ = io.WriteString(w, `{"message":`+string(message)+`,"done":true}`)
+	}))
+	defer server.Close()
+
+	agent := NewOllamaAgent(server.Client(), server.URL, 0, "", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	agent.SetModel("ollama/llama3.1", 0.5)
+	got, err := agent.CreateRefactoringResult(context.Background(), &RefactoringRequest{
+		UserPrompt:  "Refactor a.go",
+		TargetFiles: []*TargetFile{{Path: "a.go", Content: "package main\n"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateRefactoringResult() error = %v", err)
+	}
+	if !reflect.DeepEqual(got.Files, wantFiles) {
+		t.Errorf("CreateRefactoringResult() got = %v, want %v", got.Files, wantFiles)
+	}
+}
+
+func Test_OllamaAgent_CreateRefactoringResult_SystemPrompt(t *testing.T) {
+	systemPrompt := "You are an expert software engineer who refactors code."
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+			return
+		}
+		if len(req.Messages) < 2 || req.Messages[0].Role != "system" || req.Messages[0].Content != systemPrompt {
+			t.Errorf("first message must be the system prompt: %+v", req.Messages)
+		}
+		content, _ := json.Marshal(map[string]any{"files": []*RefactoredFile{{Path: "a.go", Content: "package main\n"}}})
+		message, _ := json.Marshal(ollamaChatMessage{Role: "assistant", Content: string(content)})
+		_, _ = io.WriteString(w, `{"message":`+string(message)+`,"done":true}`)
+	}))
+	defer server.Close()
+
+	agent := NewOllamaAgent(server.Client(), server.URL, 0, systemPrompt, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	agent.SetModel("ollama/llama3.1", 0.5)
+	if _, err := agent.CreateRefactoringResult(context.Background(), &RefactoringRequest{
+		UserPrompt:  "Refactor a.go",
+		TargetFiles: []*TargetFile{{Path: "a.go", Content: "package main\n"}},
+	}); err != nil {
+		t.Fatalf("CreateRefactoringResult() error = %v", err)
+	}
+}
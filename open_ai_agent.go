@@ -5,26 +5,220 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
 
 	"github.com/sashabaranov/go-openai"
 	"github.com/sashabaranov/go-openai/jsonschema"
 )
 
+func init() {
+	RegisterAgentProvider(&AgentProvider{
+		Name:          openAIProviderName,
+		Description:   "OpenAI API and OpenAI-compatible APIs. " + openAIAPIKeyEnv + " (" + azureOpenAIAPIKeyEnv + " for Azure OpenAI) is required unless a base URL of a self-hosted API is specified",
+		ModelPrefixes: []string{"gpt-", "o1-", "chatgpt-"},
+		Models: []string{
+			openai.GPT4o,
+			openai.GPT4oMini,
+			openai.GPT4Turbo,
+			openai.O1Preview,
+			openai.O1Mini,
+		},
+		ContextWindows: map[string]int{
+			"gpt-4o":        128000,
+			"chatgpt-4o":    128000,
+			"gpt-4-turbo":   128000,
+			"gpt-4":         8192,
+			"gpt-3.5-turbo": 16385,
+			"o1-":           128000,
+		},
+		// Self-hosted models served by OpenAI-compatible APIs often have a smaller context window
+		DefaultContextWindow: 8192,
+		MaxOutputTokens: map[string]int{
+			"gpt-4o":            16384,
+			"gpt-4o-2024-05-13": 4096,
+			"chatgpt-4o":        16384,
+			"gpt-4-turbo":       4096,
+			"gpt-4":             8192,
+			"gpt-3.5-turbo":     4096,
+			"o1-preview":        32768,
+			"o1-mini":           65536,
+		},
+		CharsPerToken: 4,
+		New: func(model string, config *AgentConfig, logger *slog.Logger) (Agent, error) {
+			openAIConfig := config.OpenAI
+			if openAIConfig == nil {
+				openAIConfig = &OpenAIConfig{}
+			}
+			apiKeyEnv := config.apiKeyEnv(openAIConfig.apiKeyEnv())
+			apiKey := os.Getenv(apiKeyEnv)
+			if apiKey == "" && openAIConfig.apiKeyRequired() {
+				return nil, fmt.Errorf("Env '%s' must be defined for model %s", apiKeyEnv, model)
+			}
+			clientConfig, err := openAIConfig.clientConfig(apiKey)
+			if err != nil {
+				return nil, fmt.Errorf("invalid OpenAI config: %w", err)
+			}
+			client := openai.NewClientWithConfig(clientConfig)
+			return NewOpenAIAgent(client, config.SystemPrompt, logger), nil
+		},
+	})
+}
+
+const (
+	openAIProviderName  = "openai"
+	openAIAPITypeOpenAI = "openai"
+	openAIAPITypeAzure  = "azure"
+
+	openAIBaseURLEnv         = "OPENAI_BASE_URL"
+	openAIAPITypeEnv         = "OPENAI_API_TYPE"
+	openAIAPIVersionEnv      = "OPENAI_API_VERSION"
+	openAIExtraHeadersEnv    = "OPENAI_EXTRA_HEADERS"
+	azureOpenAIAPIKeyEnv     = "AZURE_OPENAI_API_KEY"
+	azureOpenAIEndpointEnv   = "AZURE_OPENAI_ENDPOINT"
+	azureOpenAIDeploymentEnv = "AZURE_OPENAI_DEPLOYMENT"
+)
+
+// OpenAIConfig is a configuration for OpenAI API and OpenAI-compatible APIs like vLLM, LiteLLM, LocalAI and Azure OpenAI.
+type OpenAIConfig struct {
+	// BaseURL is a base URL of the API. https://api.openai.com/v1 is used if empty.
+	// For Azure OpenAI, it's an endpoint like https://<resource>.openai.azure.com/
+	BaseURL string
+	// APIType is "openai" or "azure". Default is "openai".
+	APIType string
+	// APIVersion is a version of the API. It's required for Azure OpenAI.
+	APIVersion string
+	// Deployment is a deployment name of Azure OpenAI. The model name is used as a deployment name if empty.
+	Deployment string
+	// Headers are extra HTTP headers sent with every request. e.g. an API key header of a gateway.
+	Headers map[string]string
+}
+
+// NewOpenAIConfigFromEnv creates `OpenAIConfig` from environment variables.
+func NewOpenAIConfigFromEnv() (*OpenAIConfig, error) {
+	c := &OpenAIConfig{
+		BaseURL:    os.Getenv(openAIBaseURLEnv),
+		APIType:    os.Getenv(openAIAPITypeEnv),
+		APIVersion: os.Getenv(openAIAPIVersionEnv),
+		Deployment: os.Getenv(azureOpenAIDeploymentEnv),
+		Headers:    make(map[string]string),
+	}
+	if c.BaseURL == "" {
+		c.BaseURL = os.Getenv(azureOpenAIEndpointEnv)
+		if c.BaseURL != "" && c.APIType == "" {
+			c.APIType = openAIAPITypeAzure
+		}
+	}
+	if v := os.Getenv(openAIExtraHeadersEnv); v != "" {
+		// Format: "Key1: Value1, Key2: Value2"
+		for _, h := range strings.Split(v, ",") {
+			if err := c.AddHeader(h); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", openAIExtraHeadersEnv, err)
+			}
+		}
+	}
+	return c, nil
+}
+
+// AddHeader adds an extra HTTP header which is given as "Key: Value" format.
+func (c *OpenAIConfig) AddHeader(header string) error {
+	key, value, ok := strings.Cut(header, ":")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return fmt.Errorf("header must be 'Key: Value' format: '%s'", header)
+	}
+	if c.Headers == nil {
+		c.Headers = make(map[string]string)
+	}
+	c.Headers[key] = strings.TrimSpace(value)
+	return nil
+}
+
+func (c *OpenAIConfig) isAzure() bool {
+	return strings.EqualFold(c.APIType, openAIAPITypeAzure)
+}
+
+// apiKeyEnv returns a name of environment variable for API key.
+func (c *OpenAIConfig) apiKeyEnv() string {
+	if c.isAzure() && os.Getenv(azureOpenAIAPIKeyEnv) != "" {
+		return azureOpenAIAPIKeyEnv
+	}
+	return openAIAPIKeyEnv
+}
+
+// apiKeyRequired returns false for self-hosted OpenAI-compatible APIs which may not require API key.
+func (c *OpenAIConfig) apiKeyRequired() bool {
+	return c.BaseURL == "" || c.isAzure()
+}
+
+func (c *OpenAIConfig) clientConfig(apiKey string) (openai.ClientConfig, error) {
+	var config openai.ClientConfig
+	switch strings.ToLower(c.APIType) {
+	case "", openAIAPITypeOpenAI:
+		config = openai.DefaultConfig(apiKey)
+		if c.BaseURL != "" {
+			config.BaseURL = c.BaseURL
+		}
+		config.APIVersion = c.APIVersion
+	case openAIAPITypeAzure:
+		if c.BaseURL == "" {
+			return config, fmt.Errorf("base URL must be specified for Azure OpenAI")
+		}
+		config = openai.DefaultAzureConfig(apiKey, c.BaseURL)
+		if c.APIVersion != "" {
+			config.APIVersion = c.APIVersion
+		}
+		if c.Deployment != "" {
+			deployment := c.Deployment
+			config.AzureModelMapperFunc = func(string) string { return deployment }
+		}
+	default:
+		return config, fmt.Errorf("unknown API type '%s': must be '%s' or '%s'", c.APIType, openAIAPITypeOpenAI, openAIAPITypeAzure)
+	}
+	if len(c.Headers) > 0 {
+		config.HTTPClient = &http.Client{
+			Transport: &headerTransport{
+				base:    http.DefaultTransport,
+				headers: c.Headers,
+			},
+		}
+	}
+	return config, nil
+}
+
+// headerTransport is a http.RoundTripper which adds extra headers to every request.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	return t.base.RoundTrip(req)
+}
+
 type OpenAIAgent struct {
-	client *openai.Client
-	logger *slog.Logger
-	model  string
+	client       *openai.Client
+	logger       *slog.Logger
+	model        string
+	systemPrompt string
 }
 
-func NewOpenAIAgent(client *openai.Client, logger *slog.Logger) Agent {
+func NewOpenAIAgent(client *openai.Client, systemPrompt string, logger *slog.Logger) Agent {
 	return &OpenAIAgent{
-		client: client,
-		logger: logger,
+		client:       client,
+		logger:       logger,
+		systemPrompt: systemPrompt,
 	}
 }
 
 func (a *OpenAIAgent) CreateRefactoringTarget(ctx context.Context, prompt string, model string, temperature float32) (*RefactoringTarget, error) {
-	a.model = model
+	a.model = trimProviderName(model, openAIProviderName)
 	functionDefinition := &openai.FunctionDefinition{
 		Name:        functionName,
 		Description: functionDescription,
@@ -52,12 +246,10 @@ func (a *OpenAIAgent) CreateRefactoringTarget(ctx context.Context, prompt string
 	resp, err := a.client.CreateChatCompletion(
 		ctx,
 		openai.ChatCompletionRequest{
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: prompt,
-				},
-			},
+			Messages: a.newMessages(openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleUser,
+				Content: prompt,
+			}),
 			Model:       a.model,
 			Temperature: temperature,
 			Tools: []openai.Tool{
@@ -97,6 +289,10 @@ func (a *OpenAIAgent) CreateRefactoringTarget(ctx context.Context, prompt string
 	return target.Unique(), nil
 }
 
+func (a *OpenAIAgent) SetModel(model string, temperature float32) {
+	a.model = trimProviderName(model, openAIProviderName)
+}
+
 func (a *OpenAIAgent) CreateRefactoringResult(ctx context.Context, req *RefactoringRequest) (*RefactoringResult, error) {
 	// TODO: https://platform.openai.com/docs/guides/function-calling
 	// Preserve first result message
@@ -109,23 +305,88 @@ func (a *OpenAIAgent) CreateRefactoringResult(ctx context.Context, req *Refactor
 	}
 	// fmt.Printf("--- assistanceMessage ---\n%s", assistanceMessage)
 
-	messages := make([]openai.ChatCompletionMessage, 0, 5)
-	messages = append(messages, []openai.ChatCompletionMessage{
-		{
+	messages := a.newMessages(
+		openai.ChatCompletionMessage{
 			Role:    openai.ChatMessageRoleUser,
 			Content: req.UserPrompt,
 		},
-		{
+		openai.ChatCompletionMessage{
 			Role:    openai.ChatMessageRoleAssistant,
 			Content: assistanceMessage,
 		},
-	}...)
+	)
+
+	return a.createResult(ctx, messages)
+}
+
+// newMessages returns the messages of a new conversation starting with the system prompt.
+func (a *OpenAIAgent) newMessages(messages ...openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	if a.systemPrompt == "" {
+		return messages
+	}
+	return append([]openai.ChatCompletionMessage{
+		{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: a.systemPrompt,
+		},
+	}, messages...)
+}
+
+func (a *OpenAIAgent) RepairRefactoringResult(ctx context.Context, req *RepairRequest) (*RefactoringResult, error) {
+	conversation, ok := req.Previous.conversation.([]openai.ChatCompletionMessage)
+	if !ok || len(conversation) == 0 {
+		return nil, errNoConversation
+	}
+	repairMessage, err := req.CreateRepairMessage()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create repair message: %w", err)
+	}
+
+	messages := slices.Clone(conversation)
+	toolCalls := messages[len(messages)-1].ToolCalls
+	if len(toolCalls) == 0 {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleUser,
+			Content: repairMessage,
+		})
+	}
+	// Every tool call must be responded
+	for i, toolCall := range toolCalls {
+		content := repairMessage
+		if i > 0 {
+			content = "See the first tool result"
+		}
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:       openai.ChatMessageRoleTool,
+			Content:    content,
+			ToolCallID: toolCall.ID,
+		})
+	}
+	return a.createResult(ctx, messages)
+}
 
+// createResult sends the messages and receives RefactoringResult through `submitRefactoringResult` function.
+func (a *OpenAIAgent) createResult(ctx context.Context, messages []openai.ChatCompletionMessage) (*RefactoringResult, error) {
+	parameters := resultFunctionParameters()
 	resp, err := a.client.CreateChatCompletion(
 		ctx,
 		openai.ChatCompletionRequest{
 			Model:    a.model,
 			Messages: messages,
+			Tools: []openai.Tool{
+				{
+					Type: openai.ToolTypeFunction,
+					Function: &openai.FunctionDefinition{
+						Name:        resultFunctionName,
+						Description: resultFunctionDescription,
+						Parameters:  &parameters,
+					},
+				},
+			},
+			ToolChoice: openai.ToolChoice{
+				Type:     openai.ToolTypeFunction,
+				Function: openai.ToolFunction{Name: resultFunctionName},
+			},
 		},
 	)
 	if err != nil {
@@ -135,7 +396,20 @@ func (a *OpenAIAgent) CreateRefactoringResult(ctx context.Context, req *Refactor
 		return nil, fmt.Errorf("no choices in response")
 	}
 
-	return &RefactoringResult{
-		RawContent: resp.Choices[0].Message.Content,
-	}, nil
+	message := resp.Choices[0].Message
+	result := &RefactoringResult{
+		RawContent:   message.Content,
+		conversation: append(slices.Clip(messages), message),
+	}
+	for _, toolCall := range message.ToolCalls {
+		if toolCall.Function.Name != resultFunctionName {
+			continue
+		}
+		files, err := parseResultFunctionArguments([]byte(toolCall.Function.Arguments))
+		if err != nil {
+			return nil, err
+		}
+		result.Files = append(result.Files, files...)
+	}
+	return result, nil
 }
@@ -0,0 +1,96 @@
+package corefactorer
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func Test_OpenAIConfig_clientConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *OpenAIConfig
+		wantPath   string
+		wantQuery  string
+		wantHeader map[string]string
+		wantErr    bool
+	}{
+		{
+			name: "OpenAI-compatible",
+			config: &OpenAIConfig{
+				Headers: map[string]string{"X-Gateway-Key": "secret"},
+			},
+			wantPath: "/v1/chat/completions",
+			wantHeader: map[string]string{
+				"Authorization": "Bearer api-key",
+				"X-Gateway-Key": "secret",
+			},
+		},
+		{
+			name: "Azure OpenAI",
+			config: &OpenAIConfig{
+				APIType:    "azure",
+				APIVersion: "2024-06-01",
+				Deployment: "my-deployment",
+			},
+			wantPath:  "/openai/deployments/my-deployment/chat/completions",
+			wantQuery: "api-version=2024-06-01",
+			wantHeader: map[string]string{
+				"Api-Key": "api-key",
+			},
+		},
+		{
+			name: "unknown API type",
+			config: &OpenAIConfig{
+				APIType: "unknown",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tt.wantPath {
+					t.Errorf("path = %v, want %v", r.URL.Path, tt.wantPath)
+				}
+				if r.URL.RawQuery != tt.wantQuery {
+					t.Errorf("query = %v, want %v", r.URL.RawQuery, tt.wantQuery)
+				}
+				for k, v := range tt.wantHeader {
+					if got := r.Header.Get(k); got != v {
+						t.Errorf("header %s = %v, want %v", k, got, v)
+					}
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`)
+			}))
+			defer server.Close()
+
+			tt.config.BaseURL = server.URL
+			if tt.config.APIType == "" {
+				tt.config.BaseURL += "/v1"
+			}
+			config, err := tt.config.clientConfig("api-key")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("clientConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			client := openai.NewClientWithConfig(config)
+			_, err = client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+				Model: openai.GPT4oMini,
+				Messages: []openai.ChatCompletionMessage{
+					{Role: openai.ChatMessageRoleUser, Content: "hello"},
+				},
+			})
+			if err != nil {
+				t.Fatalf("CreateChatCompletion() error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package corefactorer
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// maxConventionFileSize is a max size of a convention file like CONTRIBUTING.md included in the system prompt.
+	// The rest is truncated to keep the system prompt small.
+	maxConventionFileSize = 8000
+	truncatedFileSuffix   = "\n... (truncated)\n"
+
+	editorConfigFile = ".editorconfig"
+)
+
+var (
+	golangciConfigFiles = []string{".golangci.yml", ".golangci.yaml"}
+	contributingFiles   = []string{"CONTRIBUTING.md", ".github/CONTRIBUTING.md", "docs/CONTRIBUTING.md"}
+)
+
+//go:embed system.template
+var systemTemplate string
+
+// ProjectInfo is information of the project which is refactored. It's available in prompt templates as `.Project`,
+// and the conventions are sent to GenAI as the system prompt.
+type ProjectInfo struct {
+	// ModulePath is a module path in go.mod.
+	ModulePath string
+	// GoVersion is a Go version in go.mod.
+	GoVersion string
+	// StyleGuide is a content of the style guide of the project.
+	StyleGuide string
+	// Linters are linters enabled in the configuration of golangci-lint.
+	Linters []string
+	// Contributing is a content of CONTRIBUTING.md.
+	Contributing string
+	// EditorConfig is a content of .editorconfig.
+	EditorConfig string
+}
+
+// LoadProjectInfo reads go.mod, the configuration of golangci-lint, CONTRIBUTING.md and .editorconfig in `dir`,
+// and the style guide file. Files which don't exist are skipped, and the style guide is skipped if `styleGuidePath` is empty.
+func LoadProjectInfo(dir string, styleGuidePath string) (*ProjectInfo, error) {
+	info := &ProjectInfo{}
+	goModPath := filepath.Join(dir, "go.mod")
+	content, err := os.ReadFile(goModPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read '%s': %w", goModPath, err)
+	default:
+		f, err := modfile.ParseLax(goModPath, content, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse '%s': %w", goModPath, err)
+		}
+		if f.Module != nil {
+			info.ModulePath = f.Module.Mod.Path
+		}
+		if f.Go != nil {
+			info.GoVersion = f.Go.Version
+		}
+	}
+
+	if info.Linters, err = loadGolangciLinters(dir); err != nil {
+		return nil, err
+	}
+	if info.Contributing, err = readConventionFile(dir, contributingFiles...); err != nil {
+		return nil, err
+	}
+	if info.EditorConfig, err = readConventionFile(dir, editorConfigFile); err != nil {
+		return nil, err
+	}
+	if styleGuidePath != "" {
+		content, err := os.ReadFile(styleGuidePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read style guide '%s': %w", styleGuidePath, err)
+		}
+		info.StyleGuide = string(content)
+	}
+	return info, nil
+}
+
+// CreateSystemPrompt returns the system prompt which tells the role of GenAI and the conventions of the project.
+// `project` can be nil.
+func CreateSystemPrompt(project *ProjectInfo) (string, error) {
+	t, err := newPromptTemplate(systemTemplate)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %w", err)
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, struct{ Project *ProjectInfo }{Project: project}); err != nil {
+		return "", fmt.Errorf("failed to template execute: %w", err)
+	}
+	return b.String(), nil
+}
+
+// loadGolangciLinters returns the sorted linters in `linters.enable` of the configuration of golangci-lint.
+func loadGolangciLinters(dir string) ([]string, error) {
+	for _, name := range golangciConfigFiles {
+		path := filepath.Join(dir, name)
+		content, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read '%s': %w", path, err)
+		}
+		var config struct {
+			Linters struct {
+				Enable []string `yaml:"enable"`
+			} `yaml:"linters"`
+		}
+		if err := yaml.Unmarshal(content, &config); err != nil {
+			return nil, fmt.Errorf("failed to parse '%s': %w", path, err)
+		}
+		linters := slices.Clone(config.Linters.Enable)
+		slices.Sort(linters)
+		return slices.Compact(linters), nil
+	}
+	return nil, nil
+}
+
+// readConventionFile returns the content of the first file found in `names`. It's truncated to maxConventionFileSize.
+func readConventionFile(dir string, names ...string) (string, error) {
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		content, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read '%s': %w", path, err)
+		}
+		if len(content) > maxConventionFileSize {
+			return strings.ToValidUTF8(string(content[:maxConventionFileSize]), "") + truncatedFileSuffix, nil
+		}
+		return string(content), nil
+	}
+	return "", nil
+}
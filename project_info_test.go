@@ -0,0 +1,117 @@
+package corefactorer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_LoadProjectInfo(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":                  "module example.com/x\n\ngo 1.22.0\n",
+		"STYLE.md":                "Wrap errors.\n",
+		".golangci.yml":           "linters:\n  enable:\n    - revive\n    - errcheck\n",
+		".github/CONTRIBUTING.md": "Write table driven tests.\n",
+		".editorconfig":           "[*.go]\nindent_style = tab\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := LoadProjectInfo(dir, filepath.Join(dir, "STYLE.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ProjectInfo{
+		ModulePath:   "example.com/x",
+		GoVersion:    "1.22.0",
+		StyleGuide:   "Wrap errors.\n",
+		Linters:      []string{"errcheck", "revive"},
+		Contributing: "Write table driven tests.\n",
+		EditorConfig: "[*.go]\nindent_style = tab\n",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadProjectInfo() = %+v, want %+v", got, want)
+	}
+
+	got, err = LoadProjectInfo(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, &ProjectInfo{}) {
+		t.Errorf("LoadProjectInfo() without files = %+v, want empty", got)
+	}
+}
+
+func Test_readConventionFile_Truncated(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "CONTRIBUTING.md"), []byte(strings.Repeat("a", maxConventionFileSize+1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readConventionFile(dir, contributingFiles...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Repeat("a", maxConventionFileSize) + truncatedFileSuffix; got != want {
+		t.Errorf("readConventionFile() length = %d, want %d", len(got), len(want))
+	}
+}
+
+func Test_CreateSystemPrompt(t *testing.T) {
+	tests := map[string]struct {
+		project  *ProjectInfo
+		want     []string
+		dontWant string
+	}{
+		"conventions": {
+			project: &ProjectInfo{
+				ModulePath:   "example.com/x",
+				GoVersion:    "1.22.0",
+				Linters:      []string{"errcheck", "revive"},
+				Contributing: "Write table driven tests.\n",
+				EditorConfig: "[*.go]\nindent_style = tab\n",
+			},
+			want: []string{
+				"You are an expert software engineer",
+				"- Module path: example.com/x\n- Go version: 1.22.0.",
+				"- Enabled linters of golangci-lint: errcheck, revive.",
+				"## .editorconfig\n```ini\n[*.go]\nindent_style = tab\n```\n",
+				"## Contributing guide\nWrite table driven tests.\n",
+			},
+		},
+		"no conventions": {
+			project:  &ProjectInfo{},
+			want:     []string{"You are an expert software engineer"},
+			dontWant: "# Project conventions",
+		},
+		"nil project": {
+			want:     []string{"You are an expert software engineer"},
+			dontWant: "# Project conventions",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := CreateSystemPrompt(tt.project)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("CreateSystemPrompt() got = %v, want containing %v", got, w)
+				}
+			}
+			if tt.dontWant != "" && strings.Contains(got, tt.dontWant) {
+				t.Errorf("CreateSystemPrompt() got = %v, must not contain %v", got, tt.dontWant)
+			}
+		})
+	}
+}
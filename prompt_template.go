@@ -0,0 +1,99 @@
+package corefactorer
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// DefaultPromptLanguage is a language of the built-in prompt template used by default.
+const DefaultPromptLanguage = "ja"
+
+var (
+	//go:embed prompt_en.template
+	promptTemplateEn string
+	//go:embed prompt_ja.template
+	promptTemplateJa string
+
+	builtinPromptTemplates = map[string]string{
+		"en": promptTemplateEn,
+		"ja": promptTemplateJa,
+	}
+
+	backticksRegexp = regexp.MustCompile("`{3,}")
+)
+
+// promptFuncs are functions available in prompt templates.
+var promptFuncs = template.FuncMap{
+	// join concatenates the elements with the separator like `{{ join .TargetPaths ", " }}`.
+	"join":  func(elems []string, sep string) string { return strings.Join(elems, sep) },
+	"trim":  strings.TrimSpace,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	// indent indents every non-empty line with the spaces.
+	"indent": func(spaces int, s string) string {
+		pad := strings.Repeat(" ", spaces)
+		lines := strings.Split(s, "\n")
+		for i, l := range lines {
+			if l != "" {
+				lines[i] = pad + l
+			}
+		}
+		return strings.Join(lines, "\n")
+	},
+	// fence returns a code fence longer than any backticks in the content, so that a Markdown file is quoted correctly.
+	"fence": func(content string) string {
+		n := 3
+		for _, m := range backticksRegexp.FindAllString(content, -1) {
+			n = max(n, len(m)+1)
+		}
+		return strings.Repeat("`", n)
+	},
+	// fileLang returns a language name of a code block from the file extension like `go` for `main.go`.
+	"fileLang": func(path string) string {
+		return strings.TrimPrefix(filepath.Ext(path), ".")
+	},
+}
+
+// PromptLanguages returns the languages of the built-in prompt templates.
+func PromptLanguages() []string {
+	languages := make([]string, 0, len(builtinPromptTemplates))
+	for lang := range builtinPromptTemplates {
+		languages = append(languages, lang)
+	}
+	slices.Sort(languages)
+	return languages
+}
+
+// BuiltinPromptTemplate returns the built-in prompt template of the language. An empty language means DefaultPromptLanguage.
+func BuiltinPromptTemplate(lang string) (string, error) {
+	if lang == "" {
+		lang = DefaultPromptLanguage
+	}
+	text, ok := builtinPromptTemplates[lang]
+	if !ok {
+		return "", fmt.Errorf("unknown prompt language '%s': must be one of %v", lang, PromptLanguages())
+	}
+	return text, nil
+}
+
+// LoadPromptTemplate reads the template file of the assistance message and checks that it's a valid template.
+func LoadPromptTemplate(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read prompt template '%s': %w", path, err)
+	}
+	if _, err := newPromptTemplate(string(content)); err != nil {
+		return "", fmt.Errorf("failed to parse prompt template '%s': %w", path, err)
+	}
+	return string(content), nil
+}
+
+func newPromptTemplate(text string) (*template.Template, error) {
+	return template.New("prompt").Funcs(promptFuncs).Parse(text)
+}
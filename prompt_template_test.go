@@ -0,0 +1,75 @@
+package corefactorer
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_RefactoringRequest_CreateAssistanceMessage_Template(t *testing.T) {
+	tests := map[string]struct {
+		request  *RefactoringRequest
+		want     []string
+		wantErr  bool
+		dontWant string
+	}{
+		"english": {
+			request: &RefactoringRequest{
+				Language:    "en",
+				TargetFiles: []*TargetFile{{Path: "x/a.go", Content: "package x\n"}},
+				Project:     &ProjectInfo{ModulePath: "example.com/x", GoVersion: "1.22", StyleGuide: "Wrap errors with %w.\n"},
+			},
+			want: []string{
+				"Refactor the target files following the instruction of the user.",
+				"- Module: example.com/x\n- Go version: 1.22\n",
+				"### Style guide\nWrap errors with %w.\n",
+				"### x/a.go\n```go\npackage x\n",
+				"through the `submitRefactoringResult` function",
+				"## Target files: x/a.go\n",
+			},
+			dontWant: "Output format",
+		},
+		"japanese by default without project": {
+			request: &RefactoringRequest{
+				TargetFiles: []*TargetFile{{Path: "x/a.go", Content: "package x\n"}},
+			},
+			want:     []string{"ユーザーの指示に従って"},
+			dontWant: "## プロジェクト",
+		},
+		"fence longer than backticks in content": {
+			request: &RefactoringRequest{
+				Language:    "en",
+				TargetFiles: []*TargetFile{{Path: "README.md", Content: "```\ncode\n```\n"}},
+			},
+			want: []string{"### README.md\n````md\n```\ncode\n```\n\n````"},
+		},
+		"custom template with helpers": {
+			request: &RefactoringRequest{
+				UserPrompt:     "Use t.Run",
+				PromptTemplate: `{{ upper .UserPrompt }} in {{ join .NewFiles "," }} ({{ .Language }}){{ "\n" }}{{ indent 2 "a\nb" }}{{ "\n" }}{{ join .TargetPaths ", " }}`,
+				TargetFiles:    []*TargetFile{{Path: "x.go"}, {Path: "y.go"}},
+				NewFiles:       []string{"a.go", "b.go"},
+			},
+			want: []string{"USE T.RUN in a.go,b.go (ja)\n  a\n  b\nx.go, y.go"},
+		},
+		"unknown language": {
+			request: &RefactoringRequest{Language: "fr"},
+			wantErr: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := tt.request.CreateAssistanceMessage()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateAssistanceMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("CreateAssistanceMessage() got = %v, want containing %v", got, w)
+				}
+			}
+			if tt.dontWant != "" && strings.Contains(got, tt.dontWant) {
+				t.Errorf("CreateAssistanceMessage() got = %v, must not contain %v", got, tt.dontWant)
+			}
+		})
+	}
+}
@@ -4,56 +4,94 @@ import (
 	_ "embed"
 	"fmt"
 	"strings"
-	"text/template"
 )
 
-//go:embed prompt.template
-var promptTemplate string
+//go:embed repair.template
+var repairTemplate string
 
 type PullRequest struct {
-	URL   string
-	Title string
-	Body  string
-	Diff  string
+	URL   string `json:"url"`
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	Diff  string `json:"diff"`
+	// Comments are review comments and issue comments on the pull-request. They usually explain why the change is made.
+	Comments []*PullRequestComment `json:"comments,omitempty"`
+}
+
+// PullRequestComment is a comment on a pull-request.
+type PullRequestComment struct {
+	Author string `json:"author"`
+	Body   string `json:"body"`
+	// Path is a path of the file which the review comment is on. It's empty for an issue comment.
+	Path string `json:"path,omitempty"`
+	// Line is a line number in the file which the review comment is on. It's 0 if unknown.
+	Line int `json:"line,omitempty"`
 }
 
 type TargetFile struct {
-	Path    string
-	Content string
+	Path    string `json:"path"`
+	Content string `json:"content"`
 }
 
 type RefactoringRequest struct {
 	// UserPrompt is a message given from user
-	UserPrompt string
+	UserPrompt string `json:"userPrompt"`
 	// ToolCallID is an ID of ToolCall in first chat completion. It'll be used in the future.
-	ToolCallID string
-	// PullRequests is a list of pull requests to be referred. Currently only 1st PR is used.
-	PullRequests []*PullRequest
+	ToolCallID string `json:"toolCallId,omitempty"`
+	// PullRequests is a list of pull requests to be referred. It can be empty, then the user prompt alone drives the refactoring.
+	PullRequests []*PullRequest `json:"pullRequests"`
 	// TargetFiles is a list of files to be refactored.
-	TargetFiles []*TargetFile
+	TargetFiles []*TargetFile `json:"targetFiles"`
+	// NewFiles is a list of files which are allowed to be created by the refactoring.
+	NewFiles []string `json:"newFiles,omitempty"`
+	// PromptTemplate is a template of the assistance message. The built-in template of Language is used if it's empty.
+	// It's not saved in the state file with Language and Project since they're a configuration rather than a part of the request.
+	PromptTemplate string `json:"-"`
+	// Language is a language of the built-in template like `en`. DefaultPromptLanguage is used if it's empty.
+	Language string `json:"-"`
+	// Project is information of the project. It can be nil.
+	Project *ProjectInfo `json:"-"`
 }
 
 func (rr *RefactoringRequest) CreateAssistanceMessage() (string, error) {
 	var sb strings.Builder
-	t, err := template.New("prompt").Parse(promptTemplate)
+	text := rr.PromptTemplate
+	if text == "" {
+		builtin, err := BuiltinPromptTemplate(rr.Language)
+		if err != nil {
+			return "", err
+		}
+		text = builtin
+	}
+	t, err := newPromptTemplate(text)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse template: %w", err)
 	}
 
-	paths := make([]string, 0, len(rr.TargetFiles))
-	for _, tf := range rr.TargetFiles {
-		paths = append(paths, tf.Path)
+	language := rr.Language
+	if language == "" {
+		language = DefaultPromptLanguage
+	}
+	project := rr.Project
+	if project == nil {
+		project = &ProjectInfo{}
 	}
 	data := struct {
-		PullRequestURL string
-		Diff           string
-		TargetFiles    []*TargetFile
-		TargetPaths    string
+		UserPrompt   string
+		PullRequests []*PullRequest
+		TargetFiles  []*TargetFile
+		TargetPaths  []string
+		NewFiles     []string
+		Language     string
+		Project      *ProjectInfo
 	}{
-		PullRequestURL: rr.PullRequests[0].URL,
-		Diff:           rr.PullRequests[0].Diff,
-		TargetFiles:    rr.TargetFiles,
-		TargetPaths:    strings.Join(paths, ", "),
+		UserPrompt:   rr.UserPrompt,
+		PullRequests: rr.PullRequests,
+		TargetFiles:  rr.TargetFiles,
+		TargetPaths:  rr.TargetPaths(),
+		NewFiles:     rr.NewFiles,
+		Language:     language,
+		Project:      project,
 	}
 	if err := t.Execute(&sb, &data); err != nil {
 		return "", fmt.Errorf("failed to template execute: %w", err)
@@ -62,6 +100,26 @@ func (rr *RefactoringRequest) CreateAssistanceMessage() (string, error) {
 	return sb.String(), nil
 }
 
+// TargetPaths returns the paths of the target files.
+func (rr *RefactoringRequest) TargetPaths() []string {
+	paths := make([]string, 0, len(rr.TargetFiles))
+	for _, tf := range rr.TargetFiles {
+		paths = append(paths, tf.Path)
+	}
+	return paths
+}
+
+// SplitPerFile returns a request per target file. The requests share the user prompt and the pull-requests.
+func (rr *RefactoringRequest) SplitPerFile() []*RefactoringRequest {
+	requests := make([]*RefactoringRequest, 0, len(rr.TargetFiles))
+	for _, tf := range rr.TargetFiles {
+		req := *rr
+		req.TargetFiles = []*TargetFile{tf}
+		requests = append(requests, &req)
+	}
+	return requests
+}
+
 func (rr *RefactoringRequest) String() string {
 	prURLs := make([]string, len(rr.PullRequests))
 	for i, pr := range rr.PullRequests {
@@ -82,5 +140,42 @@ func (rr *RefactoringRequest) String() string {
 }
 
 type RefactoringResult struct {
-	RawContent string
+	// RawContent is a text content in the response. It's parsed as Markdown when Files is empty.
+	RawContent string `json:"rawContent,omitempty"`
+	// Files are refactored files received as structured output.
+	Files []*RefactoredFile `json:"files"`
+
+	// conversation is an Agent specific conversation which produced this result. It's used to repair the result.
+	conversation any
+}
+
+// RefactoredFile is a file refactored by GenAI.
+type RefactoredFile struct {
+	Path        string `json:"path"`
+	Content     string `json:"content"`
+	Explanation string `json:"explanation"`
+}
+
+// RepairRequest is a request to fix a refactoring result which failed the verification.
+type RepairRequest struct {
+	// Request is the original request of the refactoring.
+	Request *RefactoringRequest
+	// Previous is the result which failed the verification.
+	Previous *RefactoringResult
+	// Failure is a message of the failure like compiler errors and test failures.
+	Failure string
+	// CurrentFiles are the current contents of the refactored files.
+	CurrentFiles []*TargetFile
+}
+
+func (rr *RepairRequest) CreateRepairMessage() (string, error) {
+	var sb strings.Builder
+	t, err := newPromptTemplate(repairTemplate)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %w", err)
+	}
+	if err := t.Execute(&sb, rr); err != nil {
+		return "", fmt.Errorf("failed to template execute: %w", err)
+	}
+	return sb.String(), nil
 }
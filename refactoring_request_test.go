@@ -57,6 +57,68 @@ https://github.com/oinume/co-refactorer/pull/9
 			},
 			want: "### x/a.go",
 		},
+		{
+			name: "multiple pull requests",
+			fields: fields{
+				PullRequests: []*PullRequest{
+					{
+						URL:   "https://github.com/oinume/co-refactorer/pull/9",
+						Title: "Use map in table driven tests",
+						Diff:  "diff --git a/a_test.go b/a_test.go\n",
+					},
+					{
+						URL:   "https://github.com/oinume/co-refactorer/pull/10",
+						Title: "Use t.Run",
+						Body:  "Always use t.Run in table driven tests",
+						Diff:  "diff --git a/b_test.go b/b_test.go\n",
+					},
+				},
+				TargetFiles: []*TargetFile{
+					{
+						Path:    "x/a.go",
+						Content: "package main\n",
+					},
+				},
+				UserPrompt: "Please refactor x/a.go by referring to the pull requests.",
+			},
+			want: "### description of https://github.com/oinume/co-refactorer/pull/10\nAlways use t.Run in table driven tests",
+		},
+		{
+			name: "comments",
+			fields: fields{
+				PullRequests: []*PullRequest{
+					{
+						URL:   "https://github.com/oinume/co-refactorer/pull/9",
+						Title: "Wrap errors",
+						Diff:  "diff --git a/a.go b/a.go\n",
+						Comments: []*PullRequestComment{
+							{Author: "alice", Body: "Always wrap errors with %w here", Path: "a.go", Line: 10},
+						},
+					},
+				},
+				TargetFiles: []*TargetFile{
+					{
+						Path:    "x/a.go",
+						Content: "package main\n",
+					},
+				},
+				UserPrompt: "Please refactor x/a.go by referring to the pull request.",
+			},
+			want: "### comments on https://github.com/oinume/co-refactorer/pull/9\n\n#### alice on a.go:10\nAlways wrap errors with %w here\n",
+		},
+		{
+			name: "no pull requests",
+			fields: fields{
+				TargetFiles: []*TargetFile{
+					{
+						Path:    "x/a.go",
+						Content: "package main\n",
+					},
+				},
+				UserPrompt: "Please wrap errors with %w in x/a.go",
+			},
+			want: "### x/a.go",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -77,3 +139,41 @@ https://github.com/oinume/co-refactorer/pull/9
 		})
 	}
 }
+
+func Test_RepairRequest_CreateRepairMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		req  *RepairRequest
+		want []string
+	}{
+		{
+			name: "ok",
+			req: &RepairRequest{
+				Failure:      "a.go:3:1: syntax error",
+				CurrentFiles: []*TargetFile{{Path: "a.go", Content: "package a\n"}},
+			},
+			want: []string{"### Failure\n```\na.go:3:1: syntax error\n```", "### a.go\n```go\npackage a\n\n```"},
+		},
+		{
+			name: "fence longer than backticks in content",
+			req: &RepairRequest{
+				Failure:      "README.md: unexpected ```",
+				CurrentFiles: []*TargetFile{{Path: "README.md", Content: "````\ncode\n````\n"}},
+			},
+			want: []string{"### Failure\n````\nREADME.md: unexpected ```\n````", "### README.md\n`````md\n````\ncode\n````\n\n`````"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.req.CreateRepairMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("CreateRepairMessage() got = %v, want containing %v", got, w)
+				}
+			}
+		})
+	}
+}
@@ -12,11 +12,27 @@ import (
 
 type RefactoringTarget struct {
 	// UserPrompt is a message given from user
-	UserPrompt string
+	UserPrompt string `json:"userPrompt"`
 	// ToolCallID is an ID of ToolCall in first chat completion. It'll be used in the future.
-	ToolCallID      string
-	PullRequestURLs []string
-	Files           []string
+	ToolCallID string `json:"toolCallId,omitempty"`
+	// PullRequestURLs are URLs of pull-requests in GitHub, Gitea and Bitbucket Server or merge requests in GitLab.
+	// Commit and compare URLs of GitHub are also accepted.
+	// Commits in the local repository like `git:HEAD~1` or `git:abc123..def456` and `.patch`/`.diff` files are also accepted.
+	PullRequestURLs []string `json:"pullRequestUrls"`
+	Files           []string `json:"files"`
+	// NewFiles is a list of files which are allowed to be created by the refactoring. They are not given from GenAI.
+	NewFiles []string `json:"newFiles,omitempty"`
+}
+
+// NewRefactoringTarget creates `RefactoringTarget` from the given instruction, references and files without GenAI.
+// It's used instead of App.CreateRefactoringTarget when the references and the files are given explicitly.
+func NewRefactoringTarget(instruction string, refs []string, files []string) *RefactoringTarget {
+	target := &RefactoringTarget{
+		UserPrompt:      instruction,
+		PullRequestURLs: slices.Clone(refs),
+		Files:           slices.Clone(files),
+	}
+	return target.Unique()
 }
 
 func (rt *RefactoringTarget) String() string {
@@ -38,13 +54,21 @@ func (rt *RefactoringTarget) Unique() *RefactoringTarget {
 	slices.Sort(retVal.Files)
 	retVal.Files = slices.Compact(retVal.Files)
 
+	slices.Sort(retVal.NewFiles)
+	retVal.NewFiles = slices.Compact(retVal.NewFiles)
+
 	return &retVal
 }
 
 func (rt *RefactoringTarget) Validate() error {
 	for _, prURL := range rt.PullRequestURLs {
-		if _, _, _, err := parsePullRequestURL(prURL); err != nil {
-			return fmt.Errorf("failed to parse pull-request URL '%s': %w", prURL, err)
+		if !isReference(prURL) {
+			return fmt.Errorf("unsupported pull-request URL '%s': must be a pull-request URL of GitHub, Gitea or Bitbucket Server, a commit or compare URL of GitHub, a merge request URL of GitLab, git:<revision> or a .patch/.diff file", prURL)
+		}
+		if isPatchFileReference(prURL) {
+			if _, err := os.Stat(prURL); err != nil {
+				return fmt.Errorf("patch file '%s' doesn't exist or something wrong: %w", prURL, err)
+			}
 		}
 	}
 	for _, f := range rt.Files {
@@ -55,30 +79,48 @@ func (rt *RefactoringTarget) Validate() error {
 			return fmt.Errorf("file '%s' doesn't exist or something wrong: %w", f, err)
 		}
 	}
+	for _, f := range rt.NewFiles {
+		if f == "" {
+			return fmt.Errorf("empty file name is not allowed '%s'", f)
+		}
+	}
 	return nil
 }
 
-// parsePullRequestURL parses the given URL and returns the owner, repo, and number of the pull request.
-func parsePullRequestURL(u string) (owner string, repo string, number uint64, err error) {
+// pullRequestRef is a reference to a pull-request in GitHub, Gitea or Bitbucket Server.
+type pullRequestRef struct {
+	Host   string
+	Owner  string
+	Repo   string
+	Number int
+}
+
+// parsePullRequestURL parses the given URL and returns the host, owner, repo, and number of the pull request.
+// The host is not checked here because allowed hosts are configurable. See GitHubClients.
+func parsePullRequestURL(u string) (*pullRequestRef, error) {
 	parsedURL, err := url.Parse(u)
 	if err != nil {
-		return "", "", 0, err
+		return nil, err
 	}
 	// URL is like this: https://github.com/oinume/path-shrinker/pull/16
 	if parsedURL.Scheme != "https" {
-		return "", "", 0, fmt.Errorf("URL scheme must be https")
+		return nil, fmt.Errorf("URL scheme must be https")
 	}
-	if parsedURL.Hostname() != "github.com" { // TODO: should be configurable
-		return "", "", 0, fmt.Errorf("URL hostname must be github.com")
+	if parsedURL.Hostname() == "" {
+		return nil, fmt.Errorf("URL hostname must not be empty")
 	}
 	parts := strings.Split(strings.Trim(parsedURL.Path, "/"), "/")
 	if len(parts) < 4 || parts[2] != "pull" {
-		return "", "", 0, fmt.Errorf("URL format is incorrect")
+		return nil, fmt.Errorf("URL format is incorrect")
 	}
-	owner, repo = parts[0], parts[1]
-	number, err = strconv.ParseUint(parts[3], 10, 64)
-	if err != nil {
-		return "", "", 0, err
+	number, err := strconv.Atoi(parts[3])
+	if err != nil || number <= 0 {
+		return nil, fmt.Errorf("pull-request number must be a positive integer: %s", parts[3])
 	}
-	return owner, repo, number, nil
+	return &pullRequestRef{
+		Host:   strings.ToLower(parsedURL.Hostname()),
+		Owner:  parts[0],
+		Repo:   parts[1],
+		Number: number,
+	}, nil
 }
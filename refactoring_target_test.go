@@ -57,19 +57,20 @@ func Test_parsePullRequestURL(t *testing.T) {
 		u string
 	}
 	tests := []struct {
-		name       string
-		args       args
-		wantOwner  string
-		wantRepo   string
-		wantNumber uint64
-		wantErr    bool
+		name    string
+		args    args
+		want    *pullRequestRef
+		wantErr bool
 	}{
 		{
-			name:       "ok",
-			args:       args{u: "https://github.com/oinume/co-refactorer/pull/1"},
-			wantOwner:  "oinume",
-			wantRepo:   "co-refactorer",
-			wantNumber: 1,
+			name: "ok",
+			args: args{u: "https://github.com/oinume/co-refactorer/pull/1"},
+			want: &pullRequestRef{Host: "github.com", Owner: "oinume", Repo: "co-refactorer", Number: 1},
+		},
+		{
+			name: "GitHub Enterprise Server",
+			args: args{u: "https://GitHub.example.com/oinume/co-refactorer/pull/12/files"},
+			want: &pullRequestRef{Host: "github.example.com", Owner: "oinume", Repo: "co-refactorer", Number: 12},
 		},
 		{
 			name:    "invalid path",
@@ -77,26 +78,25 @@ func Test_parsePullRequestURL(t *testing.T) {
 			wantErr: true,
 		},
 		{
-			name:    "invalid domain",
-			args:    args{u: "https://github.org/oinume/co-refactorer/pull/1"},
+			name:    "invalid number",
+			args:    args{u: "https://github.com/oinume/co-refactorer/pull/abc"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid scheme",
+			args:    args{u: "http://github.com/oinume/co-refactorer/pull/1"},
 			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotOwner, gotRepo, gotNumber, err := parsePullRequestURL(tt.args.u)
+			got, err := parsePullRequestURL(tt.args.u)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("parsePullRequestURL() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if gotOwner != tt.wantOwner {
-				t.Errorf("parsePullRequestURL() gotOwner = %v, want %v", gotOwner, tt.wantOwner)
-			}
-			if gotRepo != tt.wantRepo {
-				t.Errorf("parsePullRequestURL() gotRepo = %v, want %v", gotRepo, tt.wantRepo)
-			}
-			if gotNumber != tt.wantNumber {
-				t.Errorf("parsePullRequestURL() gotNumber = %v, want %v", gotNumber, tt.wantNumber)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePullRequestURL() got = %+v, want %+v", got, tt.want)
 			}
 		})
 	}
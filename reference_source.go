@@ -0,0 +1,175 @@
+package corefactorer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ReferenceSource fetches a reference of refactoring like a pull-request in GitHub or a merge request in GitLab.
+type ReferenceSource interface {
+	// Match reports whether the source handles the reference URL.
+	Match(ref string) bool
+	// Fetch fetches the title, description and diff of the reference.
+	Fetch(ctx context.Context, ref string) (*PullRequest, error)
+}
+
+// findReferenceSource returns the first source which handles the reference URL.
+func findReferenceSource(sources []ReferenceSource, ref string) (ReferenceSource, error) {
+	for _, s := range sources {
+		if s.Match(ref) {
+			return s, nil
+		}
+	}
+	if host, ok := gitHubReferenceHost(ref); ok {
+		return nil, fmt.Errorf("no source handles the reference '%s': GitHub host '%s' is not allowed. Add it to GitHub hosts if it's GitHub Enterprise Server", ref, host)
+	}
+	return nil, fmt.Errorf("no source handles the reference '%s'", ref)
+}
+
+// isReference reports whether the reference is in a format of any supported reference source.
+// Whether the host is allowed or not is checked when fetching it.
+func isReference(u string) bool {
+	if _, err := parseGitReference(u); err == nil {
+		return true
+	}
+	if isPatchFileReference(u) {
+		return true
+	}
+	if isGitHubReferenceURL(u) {
+		return true
+	}
+	if _, err := parseMergeRequestURL(u); err == nil {
+		return true
+	}
+	if _, err := parseGiteaPullRequestURL(u); err == nil {
+		return true
+	}
+	if _, err := parseBitbucketPullRequestURL(u); err == nil {
+		return true
+	}
+	return false
+}
+
+// SourceHost is a host of a reference source like GitLab, Gitea and Bitbucket Server.
+type SourceHost struct {
+	// Host is a hostname in reference URLs like gitlab.example.com.
+	Host string
+	// APIBaseURL is a base URL of REST API. A default URL of each source is used if empty.
+	APIBaseURL string
+	// Token is an access token for the host.
+	Token string
+}
+
+// ParseSourceHost parses a host specified as `<host>` or `<host>=<API base URL>`.
+// The token is read from `<tokenEnv>_<HOST>` env like GITLAB_TOKEN_GITLAB_EXAMPLE_COM, then falls back to `tokenEnv`.
+func ParseSourceHost(s string, tokenEnv string) (*SourceHost, error) {
+	host, apiBaseURL, err := parseHostSpec(s)
+	if err != nil {
+		return nil, err
+	}
+	token := os.Getenv(hostTokenEnv(tokenEnv, host))
+	if token == "" {
+		token = os.Getenv(tokenEnv)
+	}
+	return &SourceHost{
+		Host:       host,
+		APIBaseURL: apiBaseURL,
+		Token:      token,
+	}, nil
+}
+
+// NewSourceHostsFromEnv returns `defaultHosts` and hosts in `hostsEnv` env (comma separated).
+func NewSourceHostsFromEnv(hostsEnv string, tokenEnv string, defaultHosts ...string) ([]*SourceHost, error) {
+	hosts := defaultHosts
+	if v := os.Getenv(hostsEnv); v != "" {
+		hosts = append(hosts, strings.Split(v, ",")...)
+	}
+	sourceHosts := make([]*SourceHost, 0, len(hosts))
+	for _, h := range hosts {
+		sh, err := ParseSourceHost(h, tokenEnv)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", hostsEnv, err)
+		}
+		sourceHosts = append(sourceHosts, sh)
+	}
+	return sourceHosts, nil
+}
+
+// apiURL returns a URL of the API path. `defaultPrefix` like `/api/v4/` is used when APIBaseURL is empty.
+func (h *SourceHost) apiURL(defaultPrefix string, path string) string {
+	base := h.APIBaseURL
+	if base == "" {
+		base = "https://" + h.Host + defaultPrefix
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+// sourceHostsByName returns a map of the hosts keyed by hostname. A latter host takes precedence over the former.
+func sourceHostsByName(hosts []*SourceHost) map[string]*SourceHost {
+	m := make(map[string]*SourceHost, len(hosts))
+	for _, h := range hosts {
+		m[h.Host] = h
+	}
+	return m
+}
+
+// sourceGet sends GET request with `header` and returns the response body and header.
+// It returns an error if the status code is not 200.
+func sourceGet(ctx context.Context, httpClient *http.Client, endpoint string, header http.Header) ([]byte, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to NewRequestWithContext: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to Do HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body) // Read the response body even if the status code is not 200.
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("status code is %d: %s", resp.StatusCode, string(body))
+	}
+	return body, resp.Header, nil
+}
+
+// parseHostSpec parses a host specified as `<host>` or `<host>=<API base URL>`.
+func parseHostSpec(s string) (string, string, error) {
+	host, apiBaseURL, _ := strings.Cut(strings.TrimSpace(s), "=")
+	host = strings.ToLower(strings.TrimSpace(host))
+	if host == "" || strings.ContainsAny(host, "/:") {
+		return "", "", fmt.Errorf("invalid host '%s': must be <host> or <host>=<API base URL>", s)
+	}
+	if apiBaseURL != "" {
+		u, err := url.Parse(apiBaseURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return "", "", fmt.Errorf("invalid API base URL in '%s'", s)
+		}
+	}
+	return host, apiBaseURL, nil
+}
+
+// hostTokenEnv returns a name of env for a token of the host like GITHUB_TOKEN_GITHUB_EXAMPLE_COM.
+func hostTokenEnv(prefix string, host string) string {
+	var b strings.Builder
+	b.WriteString(prefix)
+	b.WriteString("_")
+	for _, r := range strings.ToUpper(host) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,82 @@
+package corefactorer
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sourceTestResponse is a response of the API served by sourceFetchTest.
+type sourceTestResponse struct {
+	body string
+	// nextPage is sent as X-Next-Page header for paginated APIs of GitLab
+	nextPage string
+}
+
+// sourceFetchCase is a test case of ReferenceSource.Fetch.
+type sourceFetchCase struct {
+	name    string
+	ref     string
+	want    *PullRequest
+	wantErr bool
+}
+
+// sourceFetchTest tests ReferenceSource.Fetch of a source against an API served by httptest.
+type sourceFetchTest struct {
+	newSource func(httpClient *http.Client, hosts []*SourceHost) ReferenceSource
+	// host is the allowed host, and its API base URL is the server URL with apiPrefix.
+	host      string
+	apiPrefix string
+	token     string
+	// authHeader and authValue are the header of the token expected in every request.
+	authHeader string
+	authValue  string
+	// responses are keyed by escaped API path. `?page=<page>` is appended to the key if the request has `page` query.
+	responses map[string]sourceTestResponse
+	cases     []sourceFetchCase
+}
+
+func (st *sourceFetchTest) run(t *testing.T) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get(st.authHeader); got != st.authValue {
+			t.Errorf("%s = %v, want %v", st.authHeader, got, st.authValue)
+		}
+		key := r.URL.EscapedPath()
+		if page := r.URL.Query().Get("page"); page != "" {
+			key += "?page=" + page
+		}
+		resp, ok := st.responses[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.HasPrefix(resp.body, "{") || strings.HasPrefix(resp.body, "[") {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		if resp.nextPage != "" {
+			w.Header().Set("X-Next-Page", resp.nextPage)
+		}
+		_, _ = io.WriteString(w, resp.body)
+	}))
+	defer server.Close()
+
+	source := st.newSource(server.Client(), []*SourceHost{
+		{Host: st.host, APIBaseURL: server.URL + st.apiPrefix, Token: st.token},
+	})
+	for _, tt := range st.cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := source.Fetch(context.Background(), tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Fetch() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package corefactorer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	// DefaultStateFile is a default path of the state file.
+	DefaultStateFile = ".co-refactorer-state.json"
+
+	stateVersion = 1
+)
+
+// State is the output of each step of the refactoring pipeline: plan, fetch, generate and apply.
+// It's persisted to a JSON file between the steps so that it can be inspected and edited, and a step can be rerun
+// without the previous steps like generating with another model without fetching the pull-requests again.
+type State struct {
+	Version int `json:"version"`
+	// Target is the output of plan step.
+	Target *RefactoringTarget `json:"target,omitempty"`
+	// Request is the output of fetch step.
+	Request *RefactoringRequest `json:"request,omitempty"`
+	// Model is the model used in generate step.
+	Model string `json:"model,omitempty"`
+	// Results are the output of generate step. The request is split into multiple requests
+	// when it's generated per file or it doesn't fit in the context window.
+	Results []*StateResult `json:"results,omitempty"`
+}
+
+// StateResult is a result or an error of a request in generate step.
+type StateResult struct {
+	Request *RefactoringRequest `json:"request"`
+	Result  *RefactoringResult  `json:"result,omitempty"`
+	// Error is the error message if the request failed.
+	Error string `json:"error,omitempty"`
+}
+
+// NewStateResults converts the outcomes of CreateRefactoringResults to StateResults.
+func NewStateResults(outcomes []*RefactoringOutcome) []*StateResult {
+	results := make([]*StateResult, len(outcomes))
+	for i, o := range outcomes {
+		results[i] = &StateResult{
+			Request: o.Request,
+			Result:  o.Result,
+		}
+		if o.Err != nil {
+			results[i].Error = o.Err.Error()
+		}
+	}
+	return results
+}
+
+// Outcomes converts the results back to RefactoringOutcomes. Note that the conversations with GenAI are not persisted,
+// so the results cannot be repaired by RepairRefactoringResult.
+func (s *State) Outcomes() []*RefactoringOutcome {
+	outcomes := make([]*RefactoringOutcome, len(s.Results))
+	for i, r := range s.Results {
+		outcomes[i] = &RefactoringOutcome{
+			Request: r.Request,
+			Result:  r.Result,
+		}
+		if r.Error != "" {
+			outcomes[i].Err = errors.New(r.Error)
+		}
+	}
+	return outcomes
+}
+
+// LoadState loads the state from the JSON file.
+func LoadState(path string) (*State, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file '%s': %w", path, err)
+	}
+	var s State
+	if err := json.Unmarshal(content, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse state file '%s': %w", path, err)
+	}
+	if s.Version != stateVersion {
+		return nil, fmt.Errorf("unsupported version %d of state file '%s': must be %d", s.Version, path, stateVersion)
+	}
+	return &s, nil
+}
+
+// Save writes the state to the JSON file atomically.
+func (s *State) Save(path string) error {
+	s.Version = stateVersion
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to json.Marshal state: %w", err)
+	}
+	if err := writeFileAtomic(path, append(content, '\n')); err != nil {
+		return fmt.Errorf("failed to write state file '%s': %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package corefactorer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_State_Save_LoadState(t *testing.T) {
+	request := &RefactoringRequest{
+		UserPrompt:   "Refactor a.go",
+		PullRequests: []*PullRequest{{URL: "git:HEAD", Title: "Add A", Diff: "diff --git a/a.go b/a.go\n"}},
+		TargetFiles:  []*TargetFile{{Path: "a.go", Content: "package a\n"}},
+	}
+	outcomes := []*RefactoringOutcome{
+		{
+			Request: request,
+			Result: &RefactoringResult{
+				Files: []*RefactoredFile{{Path: "a.go", Content: "package a\n\nfunc A() {}\n", Explanation: "Add A"}},
+			},
+		},
+		{Request: request, Err: errors.New("failed to chat")},
+	}
+	state := &State{
+		Target:  &RefactoringTarget{UserPrompt: "Refactor a.go", PullRequestURLs: []string{"git:HEAD"}, Files: []string{"a.go"}},
+		Request: request,
+		Model:   "gpt-4o",
+		Results: NewStateResults(outcomes),
+	}
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := state.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := LoadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, state) {
+		t.Errorf("LoadState() = %+v, want %+v", got, state)
+	}
+	gotOutcomes := got.Outcomes()
+	if !reflect.DeepEqual(gotOutcomes[0], outcomes[0]) {
+		t.Errorf("Outcomes()[0] = %+v, want %+v", gotOutcomes[0], outcomes[0])
+	}
+	if gotOutcomes[1].Err == nil || gotOutcomes[1].Err.Error() != outcomes[1].Err.Error() {
+		t.Errorf("Outcomes()[1].Err = %v, want %v", gotOutcomes[1].Err, outcomes[1].Err)
+	}
+}
+
+func Test_LoadState_UnsupportedVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(`{"version":2}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadState(path); err == nil {
+		t.Errorf("LoadState() must return an error for an unsupported version")
+	}
+}
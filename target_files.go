@@ -0,0 +1,264 @@
+package corefactorer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+const (
+	goPackagePatternSuffix = "..."
+
+	targetSkipReasonExcluded  = "excluded"
+	targetSkipReasonIgnored   = "ignored by .gitignore"
+	targetSkipReasonGenerated = "generated file"
+	targetSkipReasonVendored  = "vendored file"
+	targetSkipReasonBinary    = "binary file"
+)
+
+// generatedFileRegexp matches the comment of generated Go files. See https://go.dev/s/generatedcode
+var generatedFileRegexp = regexp.MustCompile(`(?m)^// Code generated .* DO NOT EDIT\.$`)
+
+// SkippedFile is a file matched by a pattern in RefactoringTarget.Files but skipped from the targets.
+type SkippedFile struct {
+	Pattern string
+	Path    string
+	Reason  string
+}
+
+func (s *SkippedFile) String() string {
+	return fmt.Sprintf("%s matched by '%s' (%s)", s.Path, s.Pattern, s.Reason)
+}
+
+// ExpandFiles expands patterns in Files into file paths. A pattern is one of the followings.
+//
+//   - A Go package pattern like `./internal/...`, which matches Go files in the directory and its subdirectories
+//     with the same rule as the go command.
+//   - A glob pattern like `**/*_test.go` (`**` matches any directories).
+//   - A directory, which matches all the files in the directory and its subdirectories.
+//
+// Files matched by a pattern are skipped if they match `excludes` glob patterns, or they're ignored by .gitignore,
+// generated, vendored or binary. A literal file path is skipped only if it matches `excludes`, otherwise it's kept as is.
+// It returns an error if a pattern matches no files.
+func (rt *RefactoringTarget) ExpandFiles(ctx context.Context, excludes []string) ([]*SkippedFile, error) {
+	files, skipped, err := expandFilePatterns(ctx, "", rt.Files, excludes)
+	if err != nil {
+		return nil, err
+	}
+	rt.Files = files
+	return skipped, nil
+}
+
+// expandFilePatterns expands the patterns relative to `dir`. An empty `dir` means the current directory.
+func expandFilePatterns(ctx context.Context, dir string, patterns []string, excludes []string) ([]string, []*SkippedFile, error) {
+	var (
+		files   []string
+		skipped []*SkippedFile
+	)
+	for _, pattern := range patterns {
+		matches, err := matchFilePattern(dir, pattern)
+		if err != nil {
+			return nil, nil, err
+		}
+		if matches == nil {
+			// The excludes are applied to every form of the inputs, while the other rules aren't applied to a literal path
+			// since it's specified explicitly. It's validated by RefactoringTarget.Validate.
+			if matchAnyPattern(excludes, filepath.ToSlash(filepath.Clean(pattern))) {
+				skipped = append(skipped, &SkippedFile{Pattern: pattern, Path: pattern, Reason: targetSkipReasonExcluded})
+				continue
+			}
+			files = append(files, pattern)
+			continue
+		}
+
+		ignored, err := gitIgnoredFiles(ctx, dir, matches)
+		if err != nil {
+			return nil, nil, err
+		}
+		var kept []string
+		for _, m := range matches {
+			reason := ""
+			if matchAnyPattern(excludes, filepath.ToSlash(m)) {
+				reason = targetSkipReasonExcluded
+			} else if ignored[m] {
+				reason = targetSkipReasonIgnored
+			} else if reason, err = targetFileSkipReason(filepath.Join(dir, m), m); err != nil {
+				return nil, nil, err
+			}
+			if reason != "" {
+				skipped = append(skipped, &SkippedFile{Pattern: pattern, Path: m, Reason: reason})
+				continue
+			}
+			kept = append(kept, m)
+		}
+		if len(kept) == 0 {
+			return nil, nil, fmt.Errorf("no target files matched pattern '%s'", pattern)
+		}
+		files = append(files, kept...)
+	}
+	slices.Sort(files)
+	return slices.Compact(files), skipped, nil
+}
+
+// matchFilePattern returns the paths of files matched by the pattern. It returns nil if the pattern is a literal file path.
+func matchFilePattern(dir string, pattern string) ([]string, error) {
+	root, isGoPackage := cutGoPackagePattern(pattern)
+	switch {
+	case pattern == "":
+		return nil, nil
+	case isGoPackage:
+		return walkTargetFiles(dir, root, true)
+	case strings.ContainsAny(pattern, "*?[{"):
+		if !doublestar.ValidatePattern(filepath.ToSlash(pattern)) {
+			return nil, fmt.Errorf("invalid glob pattern '%s'", pattern)
+		}
+		matches, err := doublestar.FilepathGlob(joinDir(dir, pattern), doublestar.WithFilesOnly())
+		if err != nil {
+			return nil, fmt.Errorf("failed to glob '%s': %w", pattern, err)
+		}
+		paths := make([]string, 0, len(matches))
+		for _, m := range matches {
+			p, err := relDir(dir, m)
+			if err != nil {
+				return nil, err
+			}
+			if !slices.Contains(strings.Split(filepath.ToSlash(p), "/"), ".git") {
+				paths = append(paths, p)
+			}
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no target files matched pattern '%s'", pattern)
+		}
+		return paths, nil
+	}
+	if info, err := os.Stat(joinDir(dir, pattern)); err == nil && info.IsDir() {
+		return walkTargetFiles(dir, pattern, false)
+	}
+	return nil, nil
+}
+
+// cutGoPackagePattern returns the root directory of a Go package pattern like `./internal/...`.
+func cutGoPackagePattern(pattern string) (string, bool) {
+	if pattern == goPackagePatternSuffix {
+		return ".", true
+	}
+	root, ok := strings.CutSuffix(pattern, "/"+goPackagePatternSuffix)
+	return root, ok
+}
+
+// walkTargetFiles returns the paths of files under `root`. If `goFiles` is true, only Go files are returned and
+// directories ignored by the go command like `testdata` and nested modules with go.mod are skipped like `go list ./...`.
+// Unlike the go command, build constraints are not evaluated, so files for other platforms are included as well
+// since they need the same refactoring.
+func walkTargetFiles(dir string, root string, goFiles bool) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(joinDir(dir, root), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if name == ".git" {
+				return filepath.SkipDir
+			}
+			isRoot := p == joinDir(dir, root)
+			if goFiles && !isRoot && (name == "testdata" || name == "vendor" ||
+				strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			if goFiles && !isRoot {
+				// A nested module is not a part of the packages of the pattern
+				if _, err := os.Stat(filepath.Join(p, "go.mod")); err == nil {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || (goFiles && filepath.Ext(name) != ".go") {
+			return nil
+		}
+		rel, err := relDir(dir, p)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk directory '%s': %w", root, err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no target files found in '%s'", root)
+	}
+	return paths, nil
+}
+
+// targetFileSkipReason returns the reason why the file is skipped. It returns an empty string if the file is kept.
+func targetFileSkipReason(name string, relPath string) (string, error) {
+	if matchAnyPattern(vendoredDirPatterns, filepath.ToSlash(relPath)) {
+		return targetSkipReasonVendored, nil
+	}
+	content, err := os.ReadFile(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file '%s': %w", relPath, err)
+	}
+	if bytes.IndexByte(content[:min(len(content), 8000)], 0) >= 0 {
+		return targetSkipReasonBinary, nil
+	}
+	if generatedFileRegexp.Match(content) {
+		return targetSkipReasonGenerated, nil
+	}
+	return "", nil
+}
+
+// gitIgnoredFiles returns the paths ignored by .gitignore among `paths`.
+// It returns nothing if `dir` is not in a git repository.
+func gitIgnoredFiles(ctx context.Context, dir string, paths []string) (map[string]bool, error) {
+	cmd := exec.CommandContext(ctx, "git", "check-ignore", "-z", "--stdin")
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(strings.Join(paths, "\x00") + "\x00")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// Exit status 1 means none of the paths is ignored.
+		// Other errors mean that `dir` is not in a git repository or git is not installed.
+		return nil, nil
+	}
+	ignored := make(map[string]bool)
+	for _, p := range strings.Split(stdout.String(), "\x00") {
+		if p != "" {
+			ignored[p] = true
+		}
+	}
+	return ignored, nil
+}
+
+func joinDir(dir string, name string) string {
+	if dir == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(dir, name)
+}
+
+func relDir(dir string, name string) (string, error) {
+	if dir == "" {
+		return filepath.Clean(name), nil
+	}
+	rel, err := filepath.Rel(dir, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to get relative path of '%s': %w", name, err)
+	}
+	return rel, nil
+}
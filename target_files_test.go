@@ -0,0 +1,138 @@
+package corefactorer
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_expandFilePatterns(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".gitignore":                  "/tmp/\n",
+		"main.go":                     "package main\n",
+		"internal/a/a.go":             "package a\n",
+		"internal/a/a_test.go":        "package a\n",
+		"internal/a/a.pb.go":          "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage a\n",
+		"internal/a/testdata/x.go":    "package x\n",
+		"internal/a/README.md":        "# a\n",
+		"internal/b/b.go":             "package b\n",
+		"internal/b/logo.png":         "\x89PNG\x00\x00",
+		"internal/vendor/v/v.go":      "package v\n",
+		"tools/go.mod":                "module example.com/tools\n",
+		"tools/tools.go":              "package tools\n",
+		"tmp/ignored.go":              "package tmp\n",
+		"docs/guide.md":               "# guide\n",
+		"docs/images/architecture.md": "# architecture\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if output, err := exec.Command("git", "-C", dir, "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v: %s", err, output)
+	}
+
+	tests := []struct {
+		name        string
+		patterns    []string
+		excludes    []string
+		want        []string
+		wantSkipped []string
+		wantErr     bool
+	}{
+		{
+			name:        "go package pattern",
+			patterns:    []string{"./internal/..."},
+			want:        []string{"internal/a/a.go", "internal/a/a_test.go", "internal/b/b.go"},
+			wantSkipped: []string{"internal/a/a.pb.go"},
+		},
+		{
+			name:        "all go packages",
+			patterns:    []string{"./..."},
+			want:        []string{"internal/a/a.go", "internal/a/a_test.go", "internal/b/b.go", "main.go"},
+			wantSkipped: []string{"internal/a/a.pb.go", "tmp/ignored.go"},
+		},
+		{
+			name:     "go package pattern in nested module",
+			patterns: []string{"./tools/..."},
+			want:     []string{"tools/tools.go"},
+		},
+		{
+			name:        "glob",
+			patterns:    []string{"**/*_test.go", "**/b.go"},
+			want:        []string{"internal/a/a_test.go", "internal/b/b.go"},
+			wantSkipped: nil,
+		},
+		{
+			name:        "glob skips vendored files",
+			patterns:    []string{"internal/**/*.go"},
+			want:        []string{"internal/a/a.go", "internal/a/a_test.go", "internal/a/testdata/x.go", "internal/b/b.go"},
+			wantSkipped: []string{"internal/a/a.pb.go", "internal/vendor/v/v.go"},
+		},
+		{
+			name:        "directory",
+			patterns:    []string{"internal/b", "docs"},
+			want:        []string{"docs/guide.md", "docs/images/architecture.md", "internal/b/b.go"},
+			wantSkipped: []string{"internal/b/logo.png"},
+		},
+		{
+			name:        "excludes",
+			patterns:    []string{"./internal/..."},
+			excludes:    []string{"**/*_test.go"},
+			want:        []string{"internal/a/a.go", "internal/b/b.go"},
+			wantSkipped: []string{"internal/a/a.pb.go", "internal/a/a_test.go"},
+		},
+		{
+			name:     "literal files are kept as is",
+			patterns: []string{"internal/a/a.pb.go", "new.go"},
+			want:     []string{"internal/a/a.pb.go", "new.go"},
+		},
+		{
+			name:        "literal files matching excludes are skipped",
+			patterns:    []string{"./internal/a/a.go", "new.go"},
+			excludes:    []string{"internal/**"},
+			want:        []string{"new.go"},
+			wantSkipped: []string{"./internal/a/a.go"},
+		},
+		{
+			name:     "no matches",
+			patterns: []string{"**/*.rs"},
+			wantErr:  true,
+		},
+		{
+			name:     "all matches are skipped",
+			patterns: []string{"tmp/*.go"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotSkipped, err := expandFilePatterns(context.Background(), dir, tt.patterns, tt.excludes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandFilePatterns() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandFilePatterns() = %v, want %v", got, tt.want)
+			}
+			var skippedPaths []string
+			for _, s := range gotSkipped {
+				skippedPaths = append(skippedPaths, s.Path)
+			}
+			if !reflect.DeepEqual(skippedPaths, tt.wantSkipped) {
+				t.Errorf("expandFilePatterns() skipped = %v, want %v", skippedPaths, tt.wantSkipped)
+			}
+		})
+	}
+}
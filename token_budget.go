@@ -0,0 +1,292 @@
+package corefactorer
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultContextWindow = 8192
+	defaultCharsPerToken = 4.0
+
+	// requestOverheadTokens is tokens reserved for things not in RefactoringRequest like tool definitions
+	// and the conversation to create RefactoringTarget.
+	requestOverheadTokens = 1024
+	// outputOverheadTokens is tokens reserved for explanations and structure of the result in addition to file contents.
+	outputOverheadTokens = 1024
+
+	diffDropReasonOverBudget = "over token budget"
+)
+
+// TokenBudget is a budget of tokens of a model. Tokens are estimated from characters since tokenizers differ by provider.
+type TokenBudget struct {
+	Model string
+	// ContextWindow is a maximum number of tokens of input and output.
+	ContextWindow int
+	// CharsPerToken is an average number of ASCII characters per token.
+	CharsPerToken float64
+	// SystemPromptTokens is tokens of the system prompt sent with every request.
+	SystemPromptTokens int
+	// MaxOutputTokens is a maximum number of tokens of a response. Zero means no limit except for the context window.
+	MaxOutputTokens int
+}
+
+// TokenBudget returns a TokenBudget of the model. `contextWindow` overrides the known context window if it's positive.
+func (p *AgentProvider) TokenBudget(model string, contextWindow int) *TokenBudget {
+	if contextWindow <= 0 {
+		contextWindow = lookupModelPrefix(p.ContextWindows, trimProviderName(model, p.Name), p.DefaultContextWindow)
+	}
+	if contextWindow <= 0 {
+		contextWindow = defaultContextWindow
+	}
+	charsPerToken := p.CharsPerToken
+	if charsPerToken <= 0 {
+		charsPerToken = defaultCharsPerToken
+	}
+	return &TokenBudget{
+		Model:           model,
+		ContextWindow:   contextWindow,
+		CharsPerToken:   charsPerToken,
+		MaxOutputTokens: p.maxOutputTokens(model),
+	}
+}
+
+// maxOutputTokens returns the max tokens of a response of the model. Zero means that it's unknown.
+func (p *AgentProvider) maxOutputTokens(model string) int {
+	return lookupModelPrefix(p.MaxOutputTokens, trimProviderName(model, p.Name), p.DefaultMaxOutputTokens)
+}
+
+// lookupModelPrefix returns the value of the longest prefix of `model` in `values`, or `defaultValue` if no prefix matches.
+func lookupModelPrefix(values map[string]int, model string, defaultValue int) int {
+	value, matched := defaultValue, -1
+	for prefix, v := range values {
+		// The longest prefix wins like gpt-4o over gpt-4
+		if strings.HasPrefix(model, prefix) && len(prefix) > matched {
+			value, matched = v, len(prefix)
+		}
+	}
+	return value
+}
+
+// EstimateTokens estimates the number of tokens of `s`. A non-ASCII character like Japanese is counted as a token
+// since it's usually encoded into one or more tokens.
+func (b *TokenBudget) EstimateTokens(s string) int {
+	ascii, nonASCII := 0, 0
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			nonASCII++
+		}
+	}
+	return int(math.Ceil(float64(ascii)/b.CharsPerToken)) + nonASCII
+}
+
+// TokenUsage is a breakdown of estimated tokens of a RefactoringRequest.
+type TokenUsage struct {
+	// Prompt is tokens of the user prompt.
+	Prompt int
+	// Template is tokens of the assistance message except for the diffs and the files.
+	Template int
+	// Diffs is tokens of the diffs of the pull-requests.
+	Diffs int
+	// Files is tokens of the target files keyed by path.
+	Files map[string]int
+	// Output is tokens reserved for the result, which includes the whole contents of the refactored files.
+	Output int
+	// Overhead is tokens reserved for tool definitions and the previous conversation.
+	Overhead int
+	// ContextWindow is the context window of the model.
+	ContextWindow int
+	// MaxOutput is the max output tokens of the model. Zero means no limit.
+	MaxOutput int
+}
+
+// Total returns the total of estimated tokens.
+func (u *TokenUsage) Total() int {
+	total := u.Prompt + u.Template + u.Diffs + u.Output + u.Overhead
+	for _, t := range u.Files {
+		total += t
+	}
+	return total
+}
+
+// Fits reports whether the total fits in the context window and the output fits in the max output tokens.
+func (u *TokenUsage) Fits() bool {
+	return u.Total() <= u.ContextWindow && (u.MaxOutput <= 0 || u.Output <= u.MaxOutput)
+}
+
+func (u *TokenUsage) String() string {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "prompt %d + template %d + diffs %d", u.Prompt, u.Template, u.Diffs)
+	paths := make([]string, 0, len(u.Files))
+	for p := range u.Files {
+		paths = append(paths, p)
+	}
+	slices.Sort(paths)
+	for _, p := range paths {
+		_, _ = fmt.Fprintf(&b, " + file %s %d", p, u.Files[p])
+	}
+	_, _ = fmt.Fprintf(&b, " + output %d + overhead %d = %d tokens (context window: %d tokens",
+		u.Output, u.Overhead, u.Total(), u.ContextWindow)
+	if u.MaxOutput > 0 {
+		_, _ = fmt.Fprintf(&b, ", max output: %d tokens", u.MaxOutput)
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// TokenUsage estimates tokens of the request with the budget.
+func (r *RefactoringRequest) TokenUsage(budget *TokenBudget) (*TokenUsage, error) {
+	message, err := r.CreateAssistanceMessage()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create assistance message: %w", err)
+	}
+	usage := &TokenUsage{
+		Prompt:        budget.EstimateTokens(r.UserPrompt),
+		Files:         make(map[string]int, len(r.TargetFiles)),
+		Overhead:      requestOverheadTokens + budget.SystemPromptTokens,
+		ContextWindow: budget.ContextWindow,
+		MaxOutput:     budget.MaxOutputTokens,
+	}
+	for _, pr := range r.PullRequests {
+		usage.Diffs += budget.EstimateTokens(pr.Diff)
+	}
+	files := 0
+	for _, f := range r.TargetFiles {
+		usage.Files[f.Path] = budget.EstimateTokens(f.Content)
+		files += usage.Files[f.Path]
+	}
+	usage.Template = max(budget.EstimateTokens(message)-usage.Diffs-files, 0)
+	usage.Output = files + outputOverheadTokens
+	return usage, nil
+}
+
+// FitToBudget returns requests which fit in the context window and the max output tokens of the budget.
+// The refactored files are returned in full, so the output grows with the target files. When the request is over budget,
+// it degrades deterministically: first the diffs are trimmed to half of the room by dropping the largest files in them,
+// then the target files are split across multiple requests in order. It returns an error with a breakdown of tokens
+// if a target file still cannot fit. The dropped files in the diffs are returned as well.
+func (r *RefactoringRequest) FitToBudget(budget *TokenBudget) ([]*RefactoringRequest, []*DroppedDiff, error) {
+	usage, err := r.TokenUsage(budget)
+	if err != nil {
+		return nil, nil, err
+	}
+	if usage.Fits() {
+		return []*RefactoringRequest{r}, nil, nil
+	}
+
+	// Trim the diffs so that the half of the room remains for the target files
+	base := *r
+	base.TargetFiles = nil
+	baseUsage, err := base.TokenUsage(budget)
+	if err != nil {
+		return nil, nil, err
+	}
+	room := budget.ContextWindow - (baseUsage.Total() - baseUsage.Diffs)
+	dropped := base.trimDiffs(budget, room/2)
+
+	var (
+		requests []*RefactoringRequest
+		chunk    []*TargetFile
+	)
+	newRequest := func(files []*TargetFile) *RefactoringRequest {
+		req := base
+		req.TargetFiles = files
+		return &req
+	}
+	for _, f := range r.TargetFiles {
+		if len(chunk) > 0 {
+			usage, err := newRequest(append(slices.Clone(chunk), f)).TokenUsage(budget)
+			if err != nil {
+				return nil, nil, err
+			}
+			if usage.Fits() {
+				chunk = append(chunk, f)
+				continue
+			}
+			requests = append(requests, newRequest(chunk))
+		}
+		usage, err := newRequest([]*TargetFile{f}).TokenUsage(budget)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !usage.Fits() {
+			return nil, nil, fmt.Errorf(
+				"'%s' cannot fit in the context window or the max output tokens of model %s even if the diffs are trimmed and the target files are split: %s",
+				f.Path, budget.Model, usage,
+			)
+		}
+		chunk = []*TargetFile{f}
+	}
+	if len(chunk) > 0 || len(requests) == 0 {
+		requests = append(requests, newRequest(chunk))
+	}
+	return requests, dropped, nil
+}
+
+// trimDiffs drops the largest files in the diffs until the diffs fit in `maxTokens`.
+// The pull-requests are copied so the original request is not modified.
+func (r *RefactoringRequest) trimDiffs(budget *TokenBudget, maxTokens int) []*DroppedDiff {
+	type entry struct {
+		pr     int
+		file   int
+		tokens int
+	}
+	var (
+		entries []*entry
+		files   = make([][]*fileDiff, len(r.PullRequests))
+		total   int
+	)
+	for i, pr := range r.PullRequests {
+		files[i] = splitDiff(pr.Diff)
+		for j, fd := range files[i] {
+			t := budget.EstimateTokens(fd.Content)
+			entries = append(entries, &entry{pr: i, file: j, tokens: t})
+			total += t
+		}
+	}
+	if total <= maxTokens {
+		return nil
+	}
+	// Largest first. Ties are broken by the order in the diffs to be deterministic.
+	slices.SortStableFunc(entries, func(a, b *entry) int {
+		return cmp.Compare(b.tokens, a.tokens)
+	})
+
+	drop := make(map[[2]int]bool)
+	var dropped []*DroppedDiff
+	for _, e := range entries {
+		if total <= maxTokens {
+			break
+		}
+		fd := files[e.pr][e.file]
+		drop[[2]int{e.pr, e.file}] = true
+		total -= e.tokens
+		dropped = append(dropped, &DroppedDiff{
+			URL:    r.PullRequests[e.pr].URL,
+			Path:   fd.Path,
+			Reason: diffDropReasonOverBudget,
+			Size:   len(fd.Content),
+		})
+	}
+
+	pullRequests := make([]*PullRequest, len(r.PullRequests))
+	for i, pr := range r.PullRequests {
+		var b strings.Builder
+		for j, fd := range files[i] {
+			if !drop[[2]int{i, j}] {
+				b.WriteString(fd.Content)
+			}
+		}
+		trimmed := *pr
+		trimmed.Diff = b.String()
+		pullRequests[i] = &trimmed
+	}
+	r.PullRequests = pullRequests
+	return dropped
+}
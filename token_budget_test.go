@@ -0,0 +1,180 @@
+package corefactorer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_AgentProvider_TokenBudget(t *testing.T) {
+	p := &AgentProvider{
+		Name: "test",
+		ContextWindows: map[string]int{
+			"gpt-4":  8192,
+			"gpt-4o": 128000,
+		},
+		DefaultContextWindow: 4096,
+		MaxOutputTokens: map[string]int{
+			"gpt-4":  8192,
+			"gpt-4o": 16384,
+		},
+	}
+	tests := []struct {
+		name          string
+		model         string
+		contextWindow int
+		want          int
+		wantMaxOutput int
+	}{
+		{name: "longest prefix", model: "gpt-4o-mini", want: 128000, wantMaxOutput: 16384},
+		{name: "shorter prefix", model: "gpt-4-0613", want: 8192, wantMaxOutput: 8192},
+		{name: "provider name", model: "test/gpt-4o", want: 128000, wantMaxOutput: 16384},
+		{name: "default", model: "llama3", want: 4096, wantMaxOutput: 0},
+		{name: "override", model: "gpt-4o", contextWindow: 1000, want: 1000, wantMaxOutput: 16384},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := p.TokenBudget(tt.model, tt.contextWindow)
+			if got.ContextWindow != tt.want {
+				t.Errorf("TokenBudget() ContextWindow = %v, want %v", got.ContextWindow, tt.want)
+			}
+			if got.MaxOutputTokens != tt.wantMaxOutput {
+				t.Errorf("TokenBudget() MaxOutputTokens = %v, want %v", got.MaxOutputTokens, tt.wantMaxOutput)
+			}
+			if got.CharsPerToken != defaultCharsPerToken {
+				t.Errorf("TokenBudget() CharsPerToken = %v, want %v", got.CharsPerToken, defaultCharsPerToken)
+			}
+		})
+	}
+}
+
+func Test_TokenBudget_EstimateTokens(t *testing.T) {
+	b := &TokenBudget{CharsPerToken: 4}
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{s: "", want: 0},
+		{s: "abcd", want: 1},
+		{s: "abcde", want: 2},
+		{s: "リファクタ", want: 5},
+	}
+	for _, tt := range tests {
+		if got := b.EstimateTokens(tt.s); got != tt.want {
+			t.Errorf("EstimateTokens(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func Test_RefactoringRequest_FitToBudget(t *testing.T) {
+	fileDiff := func(path string, size int) string {
+		return "diff --git a/" + path + " b/" + path + "\n+" + strings.Repeat("x", size) + "\n"
+	}
+	newRequest := func() *RefactoringRequest {
+		return &RefactoringRequest{
+			UserPrompt: "Refactor files",
+			PullRequests: []*PullRequest{
+				{
+					URL:  "https://github.com/oinume/co-refactorer/pull/1",
+					Diff: fileDiff("small.go", 400) + fileDiff("large.go", 40000),
+				},
+			},
+			TargetFiles: []*TargetFile{
+				{Path: "a.go", Content: strings.Repeat("a", 8000)},
+				{Path: "b.go", Content: strings.Repeat("b", 8000)},
+				{Path: "c.go", Content: strings.Repeat("c", 8000)},
+			},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		contextWindow int
+		maxOutput     int
+		wantFiles     [][]string
+		wantDropped   []string
+		wantErr       string
+	}{
+		{
+			name:          "fits",
+			contextWindow: 100000,
+			wantFiles:     [][]string{{"a.go", "b.go", "c.go"}},
+		},
+		{
+			name:          "trim diff",
+			contextWindow: 18000,
+			wantFiles:     [][]string{{"a.go", "b.go", "c.go"}},
+			wantDropped:   []string{"large.go"},
+		},
+		{
+			name:          "trim diff and split files",
+			contextWindow: 12000,
+			wantFiles:     [][]string{{"a.go", "b.go"}, {"c.go"}},
+			wantDropped:   []string{"large.go"},
+		},
+		{
+			name:          "split files over max output",
+			contextWindow: 100000,
+			maxOutput:     6000,
+			wantFiles:     [][]string{{"a.go", "b.go"}, {"c.go"}},
+		},
+		{
+			name:          "cannot fit",
+			contextWindow: 4000,
+			wantErr:       "context window: 4000 tokens",
+		},
+		{
+			name:          "cannot fit in max output",
+			contextWindow: 100000,
+			maxOutput:     2500,
+			wantErr:       "max output: 2500 tokens",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newRequest()
+			budget := &TokenBudget{Model: "test", ContextWindow: tt.contextWindow, CharsPerToken: 4, MaxOutputTokens: tt.maxOutput}
+			got, dropped, err := req.FitToBudget(budget)
+			if (err != nil) != (tt.wantErr != "") {
+				t.Fatalf("FitToBudget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("FitToBudget() error doesn't contain a breakdown %q: %v", tt.wantErr, err)
+				}
+				return
+			}
+
+			var gotFiles [][]string
+			for _, r := range got {
+				var paths []string
+				for _, f := range r.TargetFiles {
+					paths = append(paths, f.Path)
+				}
+				gotFiles = append(gotFiles, paths)
+
+				usage, err := r.TokenUsage(budget)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !usage.Fits() {
+					t.Errorf("FitToBudget() returned a request over budget: %v", usage)
+				}
+			}
+			if !reflect.DeepEqual(gotFiles, tt.wantFiles) {
+				t.Errorf("FitToBudget() files = %v, want %v", gotFiles, tt.wantFiles)
+			}
+
+			var gotDropped []string
+			for _, d := range dropped {
+				gotDropped = append(gotDropped, d.Path)
+			}
+			if !reflect.DeepEqual(gotDropped, tt.wantDropped) {
+				t.Errorf("FitToBudget() dropped = %v, want %v", gotDropped, tt.wantDropped)
+			}
+			if req.PullRequests[0].Diff != newRequest().PullRequests[0].Diff {
+				t.Errorf("FitToBudget() modified the original request")
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package corefactorer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/imports"
+)
+
+const (
+	verifyCheckParse     = "parse"
+	verifyCheckGoimports = "goimports"
+
+	// verifyPackagesPlaceholder is replaced with the packages of the applied Go files in verification commands.
+	verifyPackagesPlaceholder = "{packages}"
+)
+
+// VerificationError is returned from VerifyAppliedFiles when a check fails.
+type VerificationError struct {
+	// Check is a name of the failed check: "parse", "goimports" or the command.
+	Check string
+	// Path is a path of the file which fails the check. It's empty for commands.
+	Path string
+	// Output is a combined output of the command.
+	Output string
+	Err    error
+}
+
+func (e *VerificationError) Error() string {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "verification failed at '%s'", e.Check)
+	if e.Path != "" {
+		_, _ = fmt.Fprintf(&b, " for '%s'", e.Path)
+	}
+	_, _ = fmt.Fprintf(&b, ": %v", e.Err)
+	if e.Output != "" {
+		_, _ = fmt.Fprintf(&b, "\n%s", strings.TrimRight(e.Output, "\n"))
+	}
+	return b.String()
+}
+
+func (e *VerificationError) Unwrap() error {
+	return e.Err
+}
+
+// VerifyAppliedFiles verifies the files written by ApplyRefactoringResult.
+// Each Go file is parsed and formatted with goimports, then `commands` like `go build ./...` are executed in order.
+// `{packages}` in a command is replaced with the packages of the applied Go files, e.g. `go test {packages}`.
+// It returns `*VerificationError` when any check fails.
+func (a *App) VerifyAppliedFiles(ctx context.Context, files []*AppliedFile, commands []string) error {
+	var packages []string
+	for _, f := range files {
+		if filepath.Ext(f.Path) != ".go" {
+			continue
+		}
+		if err := a.formatGoFile(f.Path); err != nil {
+			return err
+		}
+		pkg := "./" + filepath.ToSlash(filepath.Dir(f.Path))
+		if pkg == "./." {
+			pkg = "."
+		}
+		packages = append(packages, pkg)
+	}
+	slices.Sort(packages)
+	packages = slices.Compact(packages)
+
+	for _, command := range commands {
+		args := strings.Fields(command)
+		if len(args) == 0 {
+			continue
+		}
+		expanded := make([]string, 0, len(args))
+		for _, arg := range args {
+			if arg == verifyPackagesPlaceholder {
+				expanded = append(expanded, packages...)
+			} else {
+				expanded = append(expanded, arg)
+			}
+		}
+		if slices.Contains(args, verifyPackagesPlaceholder) && len(packages) == 0 {
+			a.logger.Info(fmt.Sprintf("Skipped '%s' because no Go packages are affected", command))
+			continue
+		}
+
+		a.logger.Info(fmt.Sprintf("Running '%s'", strings.Join(expanded, " ")))
+		cmd := exec.CommandContext(ctx, expanded[0], expanded[1:]...)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return &VerificationError{
+				Check:  command,
+				Output: string(output),
+				Err:    err,
+			}
+		}
+	}
+	return nil
+}
+
+// formatGoFile parses the Go file to check syntax errors, then formats it with goimports.
+func (a *App) formatGoFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file '%s': %w", path, err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), path, content, parser.AllErrors); err != nil {
+		return &VerificationError{
+			Check: verifyCheckParse,
+			Path:  path,
+			Err:   err,
+		}
+	}
+
+	formatted, err := imports.Process(path, content, nil)
+	if err != nil {
+		return &VerificationError{
+			Check: verifyCheckGoimports,
+			Path:  path,
+			Err:   err,
+		}
+	}
+	if bytes.Equal(content, formatted) {
+		return nil
+	}
+	if err := writeFileAtomic(path, formatted); err != nil {
+		return fmt.Errorf("failed to write formatted content to file '%s': %w", path, err)
+	}
+	a.logger.Info(fmt.Sprintf("%s is formatted", path))
+	return nil
+}
+
+// VerifyAndRepairAppliedFiles verifies the applied files with VerifyAppliedFiles. While the verification fails,
+// it asks the agent to repair the refactoring and applies the repaired result up to `maxRepairAttempts` times.
+// It returns all the applied files including ones written by repairs with their original contents,
+// so the caller can restore them with RestoreFiles when it returns an error.
+func (a *App) VerifyAndRepairAppliedFiles(
+	ctx context.Context,
+	req *RefactoringRequest,
+	result *RefactoringResult,
+	applied []*AppliedFile,
+	commands []string,
+	maxRepairAttempts int,
+) ([]*AppliedFile, error) {
+	for attempt := 1; ; attempt++ {
+		verifyErr := a.VerifyAppliedFiles(ctx, applied, commands)
+		if verifyErr == nil {
+			return applied, nil
+		}
+		if attempt > maxRepairAttempts {
+			return applied, verifyErr
+		}
+		a.logger.Info(
+			fmt.Sprintf("Verification failed. Asking to repair the refactoring (%d/%d)", attempt, maxRepairAttempts),
+			slog.String("error", verifyErr.Error()),
+		)
+
+		repaired, err := a.RepairRefactoringResult(ctx, req, result, applied, verifyErr)
+		if err != nil {
+			return applied, errors.Join(verifyErr, fmt.Errorf("failed to repair the refactoring: %w", err))
+		}
+		reapplied, err := a.ApplyRefactoringResult(ctx, req, repaired)
+		if err != nil {
+			return applied, fmt.Errorf("failed to apply the repaired refactoring: %w", err)
+		}
+		applied = mergeAppliedFiles(applied, reapplied)
+		result = repaired
+	}
+}
+
+// RepairRefactoringResult asks the agent to fix the result which failed the verification with `failure`.
+// The current contents of the applied files are sent with the failure.
+func (a *App) RepairRefactoringResult(
+	ctx context.Context,
+	req *RefactoringRequest,
+	previous *RefactoringResult,
+	applied []*AppliedFile,
+	failure error,
+) (*RefactoringResult, error) {
+	if a.agent == nil {
+		return nil, errNoAgent
+	}
+	repairReq := &RepairRequest{
+		Request:  req,
+		Previous: previous,
+		Failure:  failure.Error(),
+	}
+	for _, f := range applied {
+		content, err := os.ReadFile(f.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file '%s': %w", f.Path, err)
+		}
+		repairReq.CurrentFiles = append(repairReq.CurrentFiles, &TargetFile{
+			Path:    f.Path,
+			Content: string(content),
+		})
+	}
+	return a.agent.RepairRefactoringResult(ctx, repairReq)
+}
+
+// mergeAppliedFiles merges `files` into `base`. The original content in `base` takes precedence for the same path.
+func mergeAppliedFiles(base []*AppliedFile, files []*AppliedFile) []*AppliedFile {
+	merged := slices.Clone(base)
+	for _, f := range files {
+		if !slices.ContainsFunc(merged, func(m *AppliedFile) bool { return m.Path == f.Path }) {
+			merged = append(merged, f)
+		}
+	}
+	return merged
+}
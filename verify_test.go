@@ -0,0 +1,202 @@
+package corefactorer
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_App_VerifyAppliedFiles(t *testing.T) {
+	type args struct {
+		content  string
+		commands []string
+	}
+	tests := []struct {
+		name        string
+		args        args
+		wantContent string
+		wantCheck   string
+	}{
+		{
+			name: "ok with format",
+			args: args{
+				content:  "package a\nfunc A()   {}\n",
+				commands: []string{"true"},
+			},
+			wantContent: "package a\n\nfunc A() {}\n",
+		},
+		{
+			name: "syntax error",
+			args: args{
+				content: "package a\nfunc A( {}\n",
+			},
+			wantContent: "package a\nfunc A( {}\n",
+			wantCheck:   verifyCheckParse,
+		},
+		{
+			name: "command fails",
+			args: args{
+				content:  "package a\n",
+				commands: []string{"true", "false"},
+			},
+			wantContent: "package a\n",
+			wantCheck:   "false",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "a.go")
+			if err := os.WriteFile(path, []byte(tt.args.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			app := New(slog.New(slog.NewTextHandler(os.Stdout, nil)), nil, nil, nil)
+			err := app.VerifyAppliedFiles(context.Background(), []*AppliedFile{{Path: path}}, tt.args.commands)
+			var verr *VerificationError
+			if errors.As(err, &verr) {
+				if verr.Check != tt.wantCheck {
+					t.Errorf("VerifyAppliedFiles() check = %v, want %v", verr.Check, tt.wantCheck)
+				}
+			} else if err != nil || tt.wantCheck != "" {
+				t.Errorf("VerifyAppliedFiles() error = %v, wantCheck %v", err, tt.wantCheck)
+			}
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.wantContent {
+				t.Errorf("VerifyAppliedFiles() content = %q, want %q", string(got), tt.wantContent)
+			}
+		})
+	}
+}
+
+func Test_App_RestoreFiles(t *testing.T) {
+	dir := t.TempDir()
+	modified := filepath.Join(dir, "a.go")
+	created := filepath.Join(dir, "b.go")
+	for _, path := range []string{modified, created} {
+		if err := os.WriteFile(path, []byte("package refactored\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	app := New(slog.New(slog.NewTextHandler(os.Stdout, nil)), nil, nil, nil)
+	err := app.RestoreFiles(context.Background(), []*AppliedFile{
+		{Path: modified, Original: []byte("package original\n")},
+		{Path: created, Original: nil},
+		// The same path is written twice when it's listed twice in the result
+		{Path: modified, Original: []byte("package first\n")},
+	})
+	if err != nil {
+		t.Fatalf("RestoreFiles() error = %v", err)
+	}
+
+	got, err := os.ReadFile(modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "package original\n" {
+		t.Errorf("RestoreFiles() content = %q, want %q", string(got), "package original\n")
+	}
+	if _, err := os.Stat(created); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("RestoreFiles() must remove created file: %v", err)
+	}
+}
+
+// repairAgent is an Agent which returns `repaired` from RepairRefactoringResult.
+type repairAgent struct {
+	Agent
+	repaired *RefactoringResult
+	requests []*RepairRequest
+}
+
+func (a *repairAgent) RepairRefactoringResult(ctx context.Context, req *RepairRequest) (*RefactoringResult, error) {
+	a.requests = append(a.requests, req)
+	return a.repaired, nil
+}
+
+func Test_App_VerifyAndRepairAppliedFiles(t *testing.T) {
+	type args struct {
+		maxRepairAttempts int
+	}
+	tests := []struct {
+		name        string
+		args        args
+		wantContent string
+		wantErr     bool
+	}{
+		{
+			name:        "repaired",
+			args:        args{maxRepairAttempts: 1},
+			wantContent: "package a\n\nfunc A() {}\n",
+		},
+		{
+			name:        "no repair attempts",
+			args:        args{maxRepairAttempts: 0},
+			wantContent: "package a\nfunc A( {}\n",
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chdir(t, t.TempDir())
+			if err := os.WriteFile("a.go", []byte("package a\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			agent := &repairAgent{
+				repaired: &RefactoringResult{
+					Files: []*RefactoredFile{{Path: "a.go", Content: "package a\n\nfunc A() {}\n"}},
+				},
+			}
+			app := New(slog.New(slog.NewTextHandler(os.Stdout, nil)), agent, nil, nil)
+			req := &RefactoringRequest{TargetFiles: []*TargetFile{{Path: "a.go"}}}
+			result := &RefactoringResult{
+				Files: []*RefactoredFile{{Path: "a.go", Content: "package a\nfunc A( {}\n"}},
+			}
+			applied, err := app.ApplyRefactoringResult(context.Background(), req, result)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			applied, err = app.VerifyAndRepairAppliedFiles(context.Background(), req, result, applied, nil, tt.args.maxRepairAttempts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyAndRepairAppliedFiles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(agent.requests) != tt.args.maxRepairAttempts {
+				t.Errorf("number of repair requests = %v, want %v", len(agent.requests), tt.args.maxRepairAttempts)
+			}
+			got, err := os.ReadFile("a.go")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.wantContent {
+				t.Errorf("VerifyAndRepairAppliedFiles() content = %q, want %q", string(got), tt.wantContent)
+			}
+			if string(applied[0].Original) != "package a\n" {
+				t.Errorf("VerifyAndRepairAppliedFiles() must keep the original content: %q", string(applied[0].Original))
+			}
+		})
+	}
+}
+
+// chdir changes the working directory to `dir` until the test finishes.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+}